@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"story_ai/metrics"
+	"story_ai/session"
+	"strconv"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errContentBlocked is wrapped by storytellers when the provider refuses to produce content.
+var errContentBlocked = errors.New("content blocked by the provider")
+
+// AIError is a model failure classified by its type and status code rather than its message.
+type AIError struct {
+	Type       ErrorType
+	StatusCode int           // HTTP status from the provider (gRPC codes are mapped to their HTTP equivalent); 0 if unknown
+	Blocked    bool          // The provider refused to produce the content
+	Transient  bool          // The same request may succeed if retried
+	RetryAfter time.Duration // How long the player should wait before trying again
+	Attempts   int
+	Err        error
+}
+
+func (e *AIError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AIError) Unwrap() error {
+	return e.Err
+}
+
+// backoffPolicy controls how transient model failures are retried.
+type backoffPolicy struct {
+	Attempts int
+	Base     time.Duration
+	Max      time.Duration
+}
+
+// aiBackoff is the retry policy for model calls.
+var aiBackoff = backoffPolicy{Attempts: 3, Base: 500 * time.Millisecond, Max: 8 * time.Second}
+
+// delay returns the jittered delay before the given retry (1 for the first retry):
+// half of the exponential step plus a random share of the other half.
+func (p backoffPolicy) delay(retry int) time.Duration {
+	step := p.Base << (retry - 1)
+	if step > p.Max || step <= 0 {
+		step = p.Max
+	}
+	half := step / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// classifyAIError inspects err for provider status codes, deadlines and blocked content.
+func classifyAIError(err error) *AIError {
+	var aiErr *AIError
+	if errors.As(err, &aiErr) {
+		return aiErr
+	}
+	class := &AIError{Type: ErrorTypeAI, Err: err}
+
+	var blocked *genai.BlockedError
+	var apiErr *googleapi.Error
+	var openAIErr *OpenAIAPIError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &blocked), errors.Is(err, errContentBlocked):
+		class.Blocked = true
+	case errors.Is(err, context.DeadlineExceeded):
+		class.Type = ErrorTypeTimeout
+		class.StatusCode = http.StatusGatewayTimeout
+		class.Transient = true
+	case errors.Is(err, context.Canceled):
+		class.Type = ErrorTypeNetwork
+	case errors.As(err, &apiErr):
+		class.StatusCode = apiErr.Code
+		class.RetryAfter = parseRetryAfter(apiErr.Header.Get("Retry-After"))
+		classifyStatus(class)
+	case errors.As(err, &openAIErr):
+		class.StatusCode = openAIErr.StatusCode
+		class.RetryAfter = openAIErr.RetryAfter
+		classifyStatus(class)
+	case errors.As(err, &netErr):
+		class.Type = ErrorTypeNetwork
+		if netErr.Timeout() {
+			class.Type = ErrorTypeTimeout
+		}
+		class.Transient = true
+	default:
+		// The Gemini client talks gRPC; map its status codes onto HTTP ones.
+		if st, ok := status.FromError(err); ok && st.Code() != codes.Unknown {
+			class.StatusCode = grpcHTTPStatus(st.Code())
+			classifyStatus(class)
+		}
+	}
+	return class
+}
+
+// classifyStatus sets the error type and retryability from an HTTP status code.
+func classifyStatus(class *AIError) {
+	switch code := class.StatusCode; {
+	case code == http.StatusTooManyRequests:
+		class.Type = ErrorTypeRateLimit
+		class.Transient = true
+	case code == http.StatusRequestTimeout || code == http.StatusGatewayTimeout:
+		class.Type = ErrorTypeTimeout
+		class.Transient = true
+	case code == http.StatusBadGateway || code == http.StatusServiceUnavailable:
+		class.Type = ErrorTypeNetwork
+		class.Transient = true
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		class.Type = ErrorTypeSystem
+	case code >= 500:
+		class.Type = ErrorTypeAI
+		class.Transient = true
+	default:
+		class.Type = ErrorTypeAI
+	}
+}
+
+// grpcHTTPStatus maps the gRPC codes the Gemini API returns to HTTP status codes.
+func grpcHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.NotFound:
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// callModel runs a model call behind the circuit breaker, retrying transient failures
+// with jittered exponential backoff. When it gives up, the error is an *AIError whose
+// RetryAfter is the provider's Retry-After or, failing that, the next backoff delay.
+// Tokens a failed attempt used, such as a stream cut off part way, are charged to the
+// session here; the response returned with an error carries none.
+func (h *Handler) callModel(r *http.Request, sess *session.Session, call func(ctx context.Context) (StorytellerResponse, error)) (StorytellerResponse, error) {
+	ctx := r.Context()
+	for attempt := 1; ; attempt++ {
+		resp, err := h.guardedCall(ctx, call)
+		if err == nil {
+			return resp, nil
+		}
+		if resp.Usage.TotalTokens > 0 {
+			h.recordUsage(r, sess, resp.Usage)
+		}
+
+		aiErr := classifyAIError(err)
+		aiErr.Attempts = attempt
+		wait := aiBackoff.delay(attempt)
+		if aiErr.RetryAfter > wait {
+			wait = aiErr.RetryAfter
+		}
+		if !aiErr.Transient || attempt >= aiBackoff.Attempts || wait > aiBackoff.Max {
+			if aiErr.Transient && aiErr.RetryAfter == 0 {
+				aiErr.RetryAfter = wait
+			}
+			return StorytellerResponse{}, aiErr
+		}
+
+		log.Printf("Transient %s error from %s (attempt %d, status %d), retrying in %v: %v", aiErr.Type, h.Storyteller.Name(), attempt, aiErr.StatusCode, wait, err)
+		metrics.RecordAIRetry(h.Storyteller.Name(), string(aiErr.Type))
+		select {
+		case <-ctx.Done():
+			return StorytellerResponse{}, aiErr
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"story_ai/metrics"
+	"story_ai/session"
+	"story_ai/templates"
+	"strconv"
+	"time"
+)
+
+// Fork copies the current story as it was after an earlier turn into a new branch and
+// switches the player to it. The original story is kept as the branch's parent. Forking
+// is allowed where rewinding is, and counts as a rewind on the new branch.
+func (h *Handler) Fork(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, _ := h.Manager.GetOrCreateSession(r)
+	if !canRewind(sess) {
+		http.Error(w, "This story can no longer be forked.", http.StatusForbidden)
+		return
+	}
+	turn, err := strconv.Atoi(r.FormValue("turn"))
+	if err != nil {
+		http.Error(w, "There is no such turn to fork from.", http.StatusBadRequest)
+		return
+	}
+	fork, err := h.Manager.Fork(sess.ID, turn)
+	if err != nil {
+		http.Error(w, "There is no such turn to fork from.", http.StatusBadRequest)
+		return
+	}
+
+	fork.Rewinds++
+	fork.Journal = sess.Journal.Clone()
+	fork.Journal.Rewind(turn)
+	rebuildRooms(fork)
+	metrics.RecordFork(fork.GameState.Rules.ConsequenceModel)
+
+	switchSession(w, fork)
+	renderStory(w, r, fork)
+}
+
+// Branches lists every branch of the current story.
+func (h *Handler) Branches(w http.ResponseWriter, r *http.Request) {
+	sess, _ := h.Manager.GetOrCreateSession(r)
+	branches := h.Manager.Branches(sess.ID)
+
+	depth := make(map[string]int, len(branches))
+	summaries := make([]templates.BranchSummary, len(branches))
+	for i, b := range branches {
+		if b.ParentID != "" {
+			depth[b.ID] = depth[b.ParentID] + 1
+		}
+		summaries[i] = templates.BranchSummary{
+			ID:       b.ID,
+			ParentID: b.ParentID,
+			ForkTurn: b.ForkTurn,
+			Turns:    len(b.StoryHistory) - 1,
+			Location: b.GameState.Environment.LocationName,
+			Won:      b.GameState.GameWon,
+			Lost:     b.GameState.GameLost,
+			Current:  b.ID == sess.ID,
+			Depth:    depth[b.ID],
+		}
+	}
+	templates.BranchBrowser(summaries).Render(r.Context(), w)
+}
+
+// SwitchBranch makes another branch of the current story the one being played.
+func (h *Handler) SwitchBranch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, _ := h.Manager.GetOrCreateSession(r)
+	target := h.branchOf(sess, r.FormValue("id"))
+	if target == nil {
+		http.Error(w, "That branch does not belong to this story.", http.StatusNotFound)
+		return
+	}
+	switchSession(w, target)
+	renderStory(w, r, target)
+}
+
+// CompareBranches shows two branches of the current story side by side from the
+// first page where they differ.
+func (h *Handler) CompareBranches(w http.ResponseWriter, r *http.Request) {
+	sess, _ := h.Manager.GetOrCreateSession(r)
+	a, b := h.branchOf(sess, r.FormValue("a")), h.branchOf(sess, r.FormValue("b"))
+	if a == nil || b == nil {
+		http.Error(w, "Both branches must belong to this story.", http.StatusNotFound)
+		return
+	}
+
+	from := divergence(a, b)
+	var shared *templates.BranchColumn
+	if from > 0 {
+		shared = &templates.BranchColumn{Pages: a.StoryHistory[from-1 : from]}
+	}
+	templates.BranchCompare(from, shared,
+		templates.BranchColumn{ID: a.ID, Pages: a.StoryHistory[from:]},
+		templates.BranchColumn{ID: b.ID, Pages: b.StoryHistory[from:]},
+	).Render(r.Context(), w)
+}
+
+// branchOf returns the session with the given ID if it is a branch of sess's story.
+func (h *Handler) branchOf(sess *session.Session, id string) *session.Session {
+	branches := h.Manager.Branches(sess.ID)
+	if i := slices.IndexFunc(branches, func(b *session.Session) bool { return b.ID == id }); i >= 0 {
+		return branches[i]
+	}
+	return nil
+}
+
+// divergence returns the index of the first page where two branches differ.
+func divergence(a, b *session.Session) int {
+	n := min(len(a.StoryHistory), len(b.StoryHistory))
+	for i := 0; i < n; i++ {
+		if a.StoryHistory[i].Prompt != b.StoryHistory[i].Prompt || a.StoryHistory[i].Response != b.StoryHistory[i].Response {
+			return i
+		}
+	}
+	return n
+}
+
+// switchSession points the player's session cookie at sess.
+func switchSession(w http.ResponseWriter, sess *session.Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_id",
+		Value:    sess.ID,
+		Expires:  time.Now().Add(24 * time.Hour),
+		HttpOnly: true,
+		Path:     "/",
+	})
+}
+
+// renderStory renders the whole story view for a session, as StartStory does for a new one.
+func renderStory(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	state := sess.GameState
+	templates.StoryView(sess.StoryHistory, state.PlayerStatus, state.Inventory, "#1e1e1e", sess.CurrentGenre, state.World.WorldTension, state.Rules.ConsequenceModel, placeholderFor(sess.NarratorPersona), sess.WorldMap, journalView(sess), canRewind(sess), state.GameWon || state.GameLost, sess.CurrentAuthor, sess.TotalTokens).Render(r.Context(), w)
+}
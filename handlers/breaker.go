@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"story_ai/metrics"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states, as reported by /ready and /metrics.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// errCircuitOpen is returned instead of calling the model while the breaker is open.
+var errCircuitOpen = errors.New("circuit breaker open: the story generator is unavailable")
+
+// CircuitBreaker stops calling a failing provider. It opens after FailureThreshold
+// consecutive failures, rejects calls for OpenDuration, then lets a single probe through
+// (half-open): success closes it again, failure re-opens it.
+type CircuitBreaker struct {
+	FailureThreshold int
+	OpenDuration     time.Duration
+
+	provider string
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+	mutex    sync.Mutex
+}
+
+// NewCircuitBreaker creates a closed breaker for the named provider.
+func NewCircuitBreaker(provider string, failureThreshold int, openDuration time.Duration) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		FailureThreshold: failureThreshold,
+		OpenDuration:     openDuration,
+		provider:         provider,
+		state:            BreakerClosed,
+		now:              time.Now,
+	}
+	metrics.SetCircuitBreakerState(provider, cb.state)
+	return cb
+}
+
+// Allow reports whether a call may go ahead. While open it returns how long until the
+// next probe is allowed.
+func (cb *CircuitBreaker) Allow() (bool, time.Duration) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	switch cb.state {
+	case BreakerOpen:
+		remaining := cb.OpenDuration - cb.now().Sub(cb.openedAt)
+		if remaining > 0 {
+			return false, remaining
+		}
+		cb.setState(BreakerHalfOpen)
+		cb.probing = true
+		return true, 0
+	case BreakerHalfOpen:
+		// Only one probe at a time; everyone else waits for its verdict.
+		if cb.probing {
+			return false, time.Second
+		}
+		cb.probing = true
+		return true, 0
+	default:
+		return true, 0
+	}
+}
+
+// Record reports the outcome of a call that Allow let through.
+func (cb *CircuitBreaker) Record(success bool) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.probing = false
+	if success {
+		cb.failures = 0
+		cb.setState(BreakerClosed)
+		return
+	}
+
+	cb.failures++
+	if cb.state == BreakerHalfOpen || cb.failures >= cb.FailureThreshold {
+		cb.openedAt = cb.now()
+		cb.setState(BreakerOpen)
+	}
+}
+
+// Release gives back a call that Allow let through without recording an outcome.
+func (cb *CircuitBreaker) Release() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.probing = false
+}
+
+// State returns the breaker's current state.
+func (cb *CircuitBreaker) State() string {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	return cb.state
+}
+
+func (cb *CircuitBreaker) setState(state string) {
+	if cb.state == state {
+		return
+	}
+	cb.state = state
+	metrics.SetCircuitBreakerState(cb.provider, state)
+}
+
+// guardedCall makes a single model call behind the circuit breaker and the per-call deadline.
+// Every failure counts against the breaker, including rejected API keys, except those that
+// say nothing about the provider's health: refused content, bad requests and callers
+// hanging up.
+func (h *Handler) guardedCall(ctx context.Context, call func(ctx context.Context) (StorytellerResponse, error)) (StorytellerResponse, error) {
+	if h.Breaker != nil {
+		if ok, wait := h.Breaker.Allow(); !ok {
+			return StorytellerResponse{}, &AIError{Type: ErrorTypeNetwork, RetryAfter: wait, Err: errCircuitOpen}
+		}
+	}
+
+	callCtx := ctx
+	if h.CallTimeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, h.CallTimeout)
+		defer cancel()
+	}
+	resp, err := call(callCtx)
+
+	if h.Breaker != nil {
+		switch {
+		case err == nil:
+			h.Breaker.Record(true)
+		case ctx.Err() != nil:
+			// The player went away; that says nothing about the provider.
+			h.Breaker.Release()
+		case saysNothingAboutProvider(classifyAIError(err)):
+			h.Breaker.Release()
+		default:
+			h.Breaker.Record(false)
+		}
+	}
+	return resp, err
+}
+
+// saysNothingAboutProvider reports whether a failed call was down to what was asked
+// rather than the provider: the content was refused or the request itself was rejected.
+func saysNothingAboutProvider(class *AIError) bool {
+	return class.Blocked || class.StatusCode == http.StatusBadRequest
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Budget scopes, used in errors and metrics.
+const (
+	BudgetScopeSession = "session"
+	BudgetScopeIP      = "ip"
+	BudgetScopeGlobal  = "global"
+)
+
+// BudgetExceededError is returned when a daily token budget has been used up.
+type BudgetExceededError struct {
+	Scope   string
+	Limit   int
+	Used    int
+	ResetIn time.Duration // Until the budgets are reset at midnight
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("daily %s token budget exhausted (%d of %d used)", e.Scope, e.Used, e.Limit)
+}
+
+// budgetState is the on-disk form of a day's token spending.
+type budgetState struct {
+	Day      string         `json:"day"`
+	Sessions map[string]int `json:"sessions"`
+	IPs      map[string]int `json:"ips"`
+	Global   int            `json:"global"`
+}
+
+// TokenBudget enforces daily token limits per session, per client IP and for the whole
+// server. A limit of zero disables that scope. Spending is saved to a JSON file after
+// every change so that a restart does not hand out a fresh budget.
+type TokenBudget struct {
+	SessionLimit int
+	IPLimit      int
+	GlobalLimit  int
+
+	path  string
+	state budgetState
+	now   func() time.Time
+	mutex sync.Mutex
+}
+
+// NewTokenBudget loads the spending recorded at path, if any, and returns a budget with the given limits.
+func NewTokenBudget(path string, sessionLimit, ipLimit, globalLimit int) (*TokenBudget, error) {
+	b := &TokenBudget{
+		SessionLimit: sessionLimit,
+		IPLimit:      ipLimit,
+		GlobalLimit:  globalLimit,
+		path:         path,
+		now:          time.Now,
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read token budget: %w", err)
+	default:
+		if err := json.Unmarshal(data, &b.state); err != nil {
+			return nil, fmt.Errorf("invalid token budget file %s: %w", path, err)
+		}
+	}
+	b.rollover()
+	return b, nil
+}
+
+// Check returns a *BudgetExceededError if any budget covering this session or IP is used up.
+func (b *TokenBudget) Check(sessionID, ip string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.rollover()
+
+	if b.GlobalLimit > 0 && b.state.Global >= b.GlobalLimit {
+		return &BudgetExceededError{Scope: BudgetScopeGlobal, Limit: b.GlobalLimit, Used: b.state.Global, ResetIn: b.ResetIn()}
+	}
+	if used := b.state.IPs[ip]; b.IPLimit > 0 && used >= b.IPLimit {
+		return &BudgetExceededError{Scope: BudgetScopeIP, Limit: b.IPLimit, Used: used, ResetIn: b.ResetIn()}
+	}
+	if used := b.state.Sessions[sessionID]; b.SessionLimit > 0 && used >= b.SessionLimit {
+		return &BudgetExceededError{Scope: BudgetScopeSession, Limit: b.SessionLimit, Used: used, ResetIn: b.ResetIn()}
+	}
+	return nil
+}
+
+// Spend records tokens used by a session and IP and saves the new totals.
+func (b *TokenBudget) Spend(sessionID, ip string, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.rollover()
+
+	b.state.Sessions[sessionID] += tokens
+	b.state.IPs[ip] += tokens
+	b.state.Global += tokens
+
+	if err := b.save(); err != nil {
+		log.Printf("Failed to save token budget: %v", err)
+	}
+}
+
+// ResetIn returns how long until today's budgets are reset.
+func (b *TokenBudget) ResetIn() time.Duration {
+	now := b.now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	return midnight.Sub(now)
+}
+
+// rollover starts a new day's tally once the date changes. The caller must hold the mutex
+// (or own b exclusively, as NewTokenBudget does).
+func (b *TokenBudget) rollover() {
+	today := b.now().Format("2006-01-02")
+	if b.state.Day != today {
+		b.state = budgetState{Day: today}
+	}
+	if b.state.Sessions == nil {
+		b.state.Sessions = make(map[string]int)
+	}
+	if b.state.IPs == nil {
+		b.state.IPs = make(map[string]int)
+	}
+}
+
+// save writes the state to a temporary file and renames it into place so that a crash
+// mid-write never leaves a truncated budget file behind.
+func (b *TokenBudget) save() error {
+	data, err := json.Marshal(b.state)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(b.path), ".token_budget-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), b.path)
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// cassetteEntry is a single recorded model exchange, stored as one JSONL line.
+type cassetteEntry struct {
+	Kind         string     `json:"kind"` // "tell", "correct" or "seed"
+	Key          string     `json:"key"`
+	Provider     string     `json:"provider"`
+	SystemPrompt string     `json:"system_prompt"`
+	Request      string     `json:"request"`
+	Response     string     `json:"response"`
+	Usage        TokenUsage `json:"usage"`
+	Error        string     `json:"error,omitempty"`
+	ErrorType    ErrorType  `json:"error_type,omitempty"` // The error's classification, so replay fails the same way
+	StatusCode   int        `json:"status_code,omitempty"`
+	Blocked      bool       `json:"blocked,omitempty"`
+	Transient    bool       `json:"transient,omitempty"`
+	Seed         uint64     `json:"seed,omitempty"` // A new story's dice seed, for "seed" entries
+	RecordedAt   time.Time  `json:"recorded_at"`
+}
+
+// cassetteKey hashes the message sent to the model. The system prompt is not part
+// of the key because narrator and inspiration selection are random per story.
+func cassetteKey(kind, message string) string {
+	sum := sha256.Sum256([]byte(kind + "\n" + message))
+	return hex.EncodeToString(sum[:])
+}
+
+// RecordingStoryteller wraps a Storyteller and appends every exchange to a JSONL cassette.
+type RecordingStoryteller struct {
+	inner Storyteller
+	file  *os.File
+	mutex sync.Mutex
+}
+
+// NewRecordingStoryteller opens (or creates) the cassette at path for appending.
+func NewRecordingStoryteller(inner Storyteller, path string) (*RecordingStoryteller, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+	return &RecordingStoryteller{inner: inner, file: file}, nil
+}
+
+// Name returns the wrapped provider's name.
+func (r *RecordingStoryteller) Name() string {
+	return r.inner.Name()
+}
+
+// Tell forwards the turn to the wrapped Storyteller and records the exchange.
+func (r *RecordingStoryteller) Tell(ctx context.Context, systemPrompt string, req AIRequest) (StorytellerResponse, error) {
+	reqText, err := marshalAIRequest(req)
+	if err != nil {
+		return StorytellerResponse{}, err
+	}
+	resp, err := r.inner.Tell(ctx, systemPrompt, req)
+	r.record("tell", systemPrompt, reqText, resp, err)
+	return resp, err
+}
+
+// Correct forwards the correction prompt to the wrapped Storyteller and records the exchange.
+func (r *RecordingStoryteller) Correct(ctx context.Context, systemPrompt string, retryPrompt string) (StorytellerResponse, error) {
+	resp, err := r.inner.Correct(ctx, systemPrompt, retryPrompt)
+	r.record("correct", systemPrompt, retryPrompt, resp, err)
+	return resp, err
+}
+
+// DiceSeed records the dice seed of a new story, as chosen by the wrapped Storyteller
+// if it has a say.
+func (r *RecordingStoryteller) DiceSeed(fresh uint64) uint64 {
+	if seeder, ok := r.inner.(DiceSeeder); ok {
+		fresh = seeder.DiceSeed(fresh)
+	}
+	r.write(cassetteEntry{Kind: "seed", Provider: r.inner.Name(), Seed: fresh, RecordedAt: time.Now()})
+	return fresh
+}
+
+// Close closes the cassette file.
+func (r *RecordingStoryteller) Close() error {
+	return r.file.Close()
+}
+
+func (r *RecordingStoryteller) record(kind, systemPrompt, message string, resp StorytellerResponse, callErr error) {
+	entry := cassetteEntry{
+		Kind:         kind,
+		Key:          cassetteKey(kind, message),
+		Provider:     r.inner.Name(),
+		SystemPrompt: systemPrompt,
+		Request:      message,
+		Response:     resp.Text,
+		Usage:        resp.Usage,
+		RecordedAt:   time.Now(),
+	}
+	if callErr != nil {
+		class := classifyAIError(callErr)
+		entry.Error = callErr.Error()
+		entry.ErrorType, entry.StatusCode, entry.Blocked, entry.Transient = class.Type, class.StatusCode, class.Blocked, class.Transient
+	}
+	r.write(entry)
+}
+
+func (r *RecordingStoryteller) write(entry cassetteEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Failed to encode cassette entry: %v", err)
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to write cassette entry: %v", err)
+	}
+}
+
+// recordingStreamer is a RecordingStoryteller whose wrapped backend can stream.
+type recordingStreamer struct {
+	*RecordingStoryteller
+	streamer StreamingStoryteller
+}
+
+// Streaming returns a Storyteller that also streams when the wrapped backend supports it,
+// so recording does not change how turns are delivered to the browser.
+func (r *RecordingStoryteller) Streaming() Storyteller {
+	if streamer, ok := r.inner.(StreamingStoryteller); ok {
+		return &recordingStreamer{RecordingStoryteller: r, streamer: streamer}
+	}
+	return r
+}
+
+// TellStream streams the turn from the wrapped backend and records the final text.
+func (r *recordingStreamer) TellStream(ctx context.Context, systemPrompt string, req AIRequest, onText func(raw string)) (StorytellerResponse, error) {
+	reqText, err := marshalAIRequest(req)
+	if err != nil {
+		return StorytellerResponse{}, err
+	}
+	resp, err := r.streamer.TellStream(ctx, systemPrompt, req, onText)
+	r.record("tell", systemPrompt, reqText, resp, err)
+	return resp, err
+}
+
+// ReplayStoryteller serves recorded responses from a cassette instead of calling a model.
+// Entries are matched by the hash of the request; when no entry matches, the next
+// unused entry of the same kind is served so that a playthrough can still continue.
+type ReplayStoryteller struct {
+	entries []cassetteEntry
+	used    []bool
+	byKey   map[string][]int
+	mutex   sync.Mutex
+}
+
+// NewReplayStoryteller loads every entry from the cassette at path.
+func NewReplayStoryteller(path string) (*ReplayStoryteller, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+	defer file.Close()
+
+	rs := &ReplayStoryteller{byKey: make(map[string][]int)}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry cassetteEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid cassette entry %d: %w", len(rs.entries)+1, err)
+		}
+		rs.byKey[entry.Key] = append(rs.byKey[entry.Key], len(rs.entries))
+		rs.entries = append(rs.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	rs.used = make([]bool, len(rs.entries))
+	return rs, nil
+}
+
+// Name returns the provider name used in metrics.
+func (rs *ReplayStoryteller) Name() string {
+	return "replay"
+}
+
+// Tell returns the recorded response for this turn.
+func (rs *ReplayStoryteller) Tell(ctx context.Context, systemPrompt string, req AIRequest) (StorytellerResponse, error) {
+	reqText, err := marshalAIRequest(req)
+	if err != nil {
+		return StorytellerResponse{}, err
+	}
+	return rs.play("tell", reqText)
+}
+
+// Correct returns the recorded response for this correction prompt.
+func (rs *ReplayStoryteller) Correct(ctx context.Context, systemPrompt string, retryPrompt string) (StorytellerResponse, error) {
+	return rs.play("correct", retryPrompt)
+}
+
+// DiceSeed returns the next recorded story's dice seed, or the fresh one if the cassette
+// recorded none.
+func (rs *ReplayStoryteller) DiceSeed(fresh uint64) uint64 {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	for i, entry := range rs.entries {
+		if !rs.used[i] && entry.Kind == "seed" {
+			rs.used[i] = true
+			return entry.Seed
+		}
+	}
+	log.Printf("Cassette has no dice seed left; rolling with a fresh one")
+	return fresh
+}
+
+func (rs *ReplayStoryteller) play(kind, message string) (StorytellerResponse, error) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	idx := -1
+	for _, i := range rs.byKey[cassetteKey(kind, message)] {
+		if !rs.used[i] {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		for i, entry := range rs.entries {
+			if !rs.used[i] && entry.Kind == kind {
+				log.Printf("Cassette has no entry for this %s request; replaying entry %d in order", kind, i+1)
+				idx = i
+				break
+			}
+		}
+	}
+	if idx == -1 {
+		return StorytellerResponse{}, fmt.Errorf("cassette exhausted: no recorded %s responses left", kind)
+	}
+
+	rs.used[idx] = true
+	entry := rs.entries[idx]
+	if entry.Error != "" {
+		err := errors.New(entry.Error)
+		if entry.ErrorType == "" {
+			return StorytellerResponse{}, err
+		}
+		return StorytellerResponse{}, &AIError{Type: entry.ErrorType, StatusCode: entry.StatusCode, Blocked: entry.Blocked, Transient: entry.Transient, Err: err}
+	}
+	return StorytellerResponse{Text: entry.Response, Usage: entry.Usage}, nil
+}
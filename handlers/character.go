@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"story_ai/story"
+	"story_ai/templates"
+	"strings"
+)
+
+var (
+	validGenres = []string{"fantasy", "sci-fi", "historical-fiction"}
+	validModels = []string{"exploratory", "challenging", "punishing"}
+)
+
+// CreateCharacter renders the character creation form for the chosen genre and
+// difficulty. Submitting the form starts the story.
+func (h *Handler) CreateCharacter(w http.ResponseWriter, r *http.Request) {
+	genre := r.URL.Query().Get("genre")
+	consequenceModel := r.URL.Query().Get("consequence_model")
+	if !contains(validGenres, genre) {
+		handleStartStoryError(w, r, fmt.Errorf("invalid genre parameter: %s", genre), ErrorTypeValidation)
+		return
+	}
+	if consequenceModel != "" && !contains(validModels, consequenceModel) {
+		handleStartStoryError(w, r, fmt.Errorf("invalid consequence_model parameter: %s", consequenceModel), ErrorTypeValidation)
+		return
+	}
+	templates.CharacterCreation(genre, consequenceModel, story.OptionsFor(genre)).Render(r.Context(), w)
+}
+
+// characterFromQuery builds the character submitted with a /start request. A request
+// without one, such as a restart, keeps the previous character if it suits the genre.
+func characterFromQuery(query url.Values, genre string, previous *story.Character) (*story.Character, error) {
+	if !query.Has("name") && !query.Has("role") && !query.Has("traits") {
+		if previous == nil {
+			return nil, nil
+		}
+		if c, err := story.NewCharacter(genre, previous.Name, previous.Role, previous.Traits); err == nil {
+			return c, nil
+		}
+		return nil, nil
+	}
+	c, err := story.NewCharacter(genre, query.Get("name"), query.Get("role"), query["traits"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid character: %w", err)
+	}
+	return c, nil
+}
+
+// characterLine describes a character for the PDF title page, e.g. "Ranger - brave, nimble".
+func characterLine(c *story.Character) string {
+	if len(c.Traits) == 0 {
+		return c.Role
+	}
+	return c.Role + " - " + strings.Join(c.Traits, ", ")
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"log"
+	"slices"
+	"story_ai/metrics"
+	"story_ai/session"
+	"story_ai/story"
+	"strings"
+)
+
+// Outcomes of a combine action, as counted in metrics.
+const (
+	craftRecipe = "recipe"
+	craftModel  = "model"
+)
+
+// planCraft resolves the player's action against the genre's recipes, if it combines
+// things, as the turn's craft. Combinations without a recipe are left to the model.
+func (h *Handler) planCraft(sess *session.Session, userAction string) *story.Craft {
+	sess.TurnCraft = h.Recipes.Resolve(sess.GameState, sess.CurrentGenre, userAction)
+	switch {
+	case sess.TurnCraft != nil:
+		log.Printf("Crafting in session %s: %v make %s", sess.ID, sess.TurnCraft.Consumed, sess.TurnCraft.Result.Name)
+		metrics.RecordCraft(sess.CurrentGenre, craftRecipe)
+	case h.Recipes != nil && story.IsCombineAction(userAction):
+		metrics.RecordCraft(sess.CurrentGenre, craftModel)
+	}
+	return sess.TurnCraft
+}
+
+// applyCraft puts the turn's crafted item in the new game state whatever the model wrote.
+func applyCraft(sess *session.Session, aiResp *AIResponse) {
+	added, removed := sess.TurnCraft.Apply(aiResp.NewGameState)
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	log.Printf("Crafted item applied in session %s: added %v, removed %v", sess.ID, added, removed)
+	aiResp.StoryUpdate.ItemsAdded = addUnreported(aiResp.StoryUpdate.ItemsAdded, added)
+	aiResp.StoryUpdate.ItemsRemoved = addUnreported(aiResp.StoryUpdate.ItemsRemoved, removed)
+}
+
+// addUnreported appends the names a report does not already list.
+func addUnreported(reported, names []string) []string {
+	for _, name := range names {
+		if !slices.ContainsFunc(reported, func(r string) bool { return strings.EqualFold(r, name) }) {
+			reported = append(reported, name)
+		}
+	}
+	return reported
+}
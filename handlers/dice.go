@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"log"
+	"math/rand"
+	"story_ai/metrics"
+	"story_ai/session"
+	"story_ai/story"
+)
+
+// rollCheck rolls the skill check for the player's action, if it is risky, as the turn's check.
+func rollCheck(sess *session.Session, userAction string) *story.Check {
+	sess.TurnCheck = story.Resolve(sess.GameState, userAction, sess.DiceSeed, len(sess.StoryHistory))
+	if c := sess.TurnCheck; c != nil {
+		log.Printf("Skill check in session %s: %s %v", sess.ID, c, c.Modifiers)
+	}
+	return sess.TurnCheck
+}
+
+// recordCheck counts the turn's skill check once the turn it decided is committed.
+func recordCheck(sess *session.Session) {
+	if c := sess.TurnCheck; c != nil {
+		metrics.RecordSkillCheck(c.Skill, sess.GameState.Rules.ConsequenceModel, string(c.Verdict))
+	}
+}
+
+// newDiceSeed draws the seed for a new story's skill checks, letting a recording or
+// replaying storyteller keep it in the cassette.
+func (h *Handler) newDiceSeed() uint64 {
+	seed := rand.Uint64()
+	if seeder, ok := h.Storyteller.(DiceSeeder); ok {
+		return seeder.DiceSeed(seed)
+	}
+	return seed
+}
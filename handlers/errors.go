@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"html"
+	"math"
 	"math/rand"
 	"net/http"
 	"story_ai/metrics"
@@ -22,6 +25,7 @@ const (
 	ErrorTypeSystem     ErrorType = "system"
 	ErrorTypeRateLimit  ErrorType = "rate_limit"
 	ErrorTypeTimeout    ErrorType = "timeout"
+	ErrorTypeBudget     ErrorType = "budget"
 )
 
 // UserFriendlyError represents a user-friendly error message
@@ -33,22 +37,21 @@ type UserFriendlyError struct {
 	RetryAfter time.Duration
 }
 
-// getUserFriendlyError converts technical errors into user-friendly messages
+// getUserFriendlyError converts technical errors into user-friendly messages.
+// For model failures the wait comes from the server's classification of the error.
 func getUserFriendlyError(err error, errorType ErrorType) UserFriendlyError {
-	errMsg := strings.ToLower(err.Error())
+	friendly := userFriendlyErrorFor(err, errorType)
+	var aiErr *AIError
+	if errors.As(err, &aiErr) && friendly.CanRetry {
+		friendly.RetryAfter = aiErr.RetryAfter
+	}
+	return friendly
+}
 
+func userFriendlyErrorFor(err error, errorType ErrorType) UserFriendlyError {
 	switch errorType {
 	case ErrorTypeAI:
-		if strings.Contains(errMsg, "quota") || strings.Contains(errMsg, "limit") {
-			return UserFriendlyError{
-				Type:       ErrorTypeAI,
-				Message:    "The story generator is currently busy with too many requests.",
-				Suggestion: "Please wait a moment and try again.",
-				CanRetry:   true,
-				RetryAfter: 30 * time.Second,
-			}
-		}
-		if strings.Contains(errMsg, "content") || strings.Contains(errMsg, "policy") {
+		if classifyAIError(err).Blocked {
 			return UserFriendlyError{
 				Type:       ErrorTypeAI,
 				Message:    "The story generator couldn't create content for that request.",
@@ -85,12 +88,36 @@ func getUserFriendlyError(err error, errorType ErrorType) UserFriendlyError {
 	case ErrorTypeRateLimit:
 		return UserFriendlyError{
 			Type:       ErrorTypeRateLimit,
-			Message:    "You're sending requests too quickly.",
+			Message:    "The story generator is currently busy with too many requests.",
 			Suggestion: "Please wait a moment before trying again.",
 			CanRetry:   true,
 			RetryAfter: 60 * time.Second,
 		}
 
+	case ErrorTypeBudget:
+		var budgetErr *BudgetExceededError
+		scope := BudgetScopeSession
+		suggestion := "Your story will be waiting here when the daily budget resets at midnight."
+		if errors.As(err, &budgetErr) {
+			scope = budgetErr.Scope
+			if budgetErr.ResetIn > 0 {
+				suggestion = fmt.Sprintf("Your story will be waiting here when the daily budget resets in %s.", untilReset(budgetErr.ResetIn))
+			}
+		}
+		message := "The storyteller's voice is worn out from telling your tale today."
+		switch scope {
+		case BudgetScopeIP:
+			message = "The storyteller has told too many tales to your corner of the world today."
+		case BudgetScopeGlobal:
+			message = "The storyteller has spoken to so many travellers today that their voice is gone."
+		}
+		return UserFriendlyError{
+			Type:       ErrorTypeBudget,
+			Message:    message,
+			Suggestion: suggestion,
+			CanRetry:   false,
+		}
+
 	case ErrorTypeValidation:
 		return UserFriendlyError{
 			Type:       ErrorTypeValidation,
@@ -110,6 +137,21 @@ func getUserFriendlyError(err error, errorType ErrorType) UserFriendlyError {
 	}
 }
 
+// untilReset describes the wait for a budget reset in words, to the minute under an hour
+// and to the hour after that.
+func untilReset(d time.Duration) string {
+	if d < 55*time.Minute {
+		if minutes := int(math.Ceil(d.Minutes())); minutes > 1 {
+			return fmt.Sprintf("%d minutes", minutes)
+		}
+		return "a minute"
+	}
+	if hours := int(math.Round(d.Hours())); hours > 1 {
+		return fmt.Sprintf("about %d hours", hours)
+	}
+	return "about an hour"
+}
+
 // getRandomErrorResponse returns a varied error response to keep things interesting
 func getRandomErrorResponse(baseMessage string) string {
 	responses := []string{
@@ -127,14 +169,15 @@ func getRandomErrorResponse(baseMessage string) string {
 func createErrorPage(userAction string, friendlyError UserFriendlyError) story.StoryPage {
 	var response strings.Builder
 
-	response.WriteString(getRandomErrorResponse(friendlyError.Message))
+	// Pages are rendered as raw HTML, and validation messages can quote the request
+	response.WriteString(getRandomErrorResponse(html.EscapeString(friendlyError.Message)))
 	response.WriteString("\n\n")
-	response.WriteString(fmt.Sprintf("💡 %s", friendlyError.Suggestion))
+	response.WriteString(fmt.Sprintf("💡 %s", html.EscapeString(friendlyError.Suggestion)))
 
 	if friendlyError.CanRetry {
 		response.WriteString("\n\n")
 		if friendlyError.RetryAfter > 0 {
-			response.WriteString(fmt.Sprintf("⏰ You can try again in %d seconds.", int(friendlyError.RetryAfter.Seconds())))
+			response.WriteString(fmt.Sprintf("⏰ You can try again in %d seconds.", int(math.Ceil(friendlyError.RetryAfter.Seconds()))))
 		} else {
 			response.WriteString("🔄 Feel free to try again!")
 		}
@@ -158,7 +201,7 @@ func createRetryPage(userAction string, originalError string) story.StoryPage {
 
 📝 Your original request: "%s"
 
-What would you like to do?`, originalError, userAction)
+What would you like to do?`, html.EscapeString(originalError), html.EscapeString(userAction))
 
 	return story.StoryPage{
 		Prompt:   userAction,
@@ -167,52 +210,61 @@ What would you like to do?`, originalError, userAction)
 }
 
 // handleAIError handles AI-related errors with user-friendly messages and fallback
-func handleAIError(w http.ResponseWriter, r *http.Request, sess *session.Session, userAction string, err error, startTime time.Time) {
+func (h *Handler) handleAIError(w http.ResponseWriter, r *http.Request, sess *session.Session, userAction string, err error, startTime time.Time) {
+	aiErr := classifyAIError(err)
+
 	// Record metrics
-	metrics.RecordAPIUsage("gemini", 0, time.Since(startTime), false)
-	metrics.RecordError("ai_api_failure", err.Error())
-
-	// Try fallback story generation for certain types of failures
-	if shouldUseFallback(err) {
-		fallback := &FallbackStoryGenerator{}
-		fallbackResponse, fallbackErr := fallback.GenerateFallbackStory(sess.CurrentGenre, sess.CurrentAuthor)
-		if fallbackErr == nil {
-			// Success with fallback
-			metrics.RecordStoryGeneration(time.Since(startTime), sess.CurrentGenre, sess.GameState.Rules.ConsequenceModel, true)
-
-			fallbackMessage := GetFallbackErrorMessage()
-			fallbackResponse.StoryUpdate.Story = fallbackMessage + "\n\n" + fallbackResponse.StoryUpdate.Story
-
-			sess.GameState = fallbackResponse.NewGameState
-			sess.StoryHistory = []story.StoryPage{{
-				Prompt:   "Start",
-				Response: fallbackResponse.StoryUpdate.Story,
-			}}
-
-			templates.StoryView(fallbackResponse.StoryUpdate.Story, fallbackResponse.NewGameState.PlayerStatus, fallbackResponse.NewGameState.Inventory, fallbackResponse.StoryUpdate.BackgroundColor, sess.CurrentGenre, fallbackResponse.NewGameState.World.WorldTension, sess.GameState.Rules.ConsequenceModel, "Continue the story...").Render(r.Context(), w)
-			return
-		}
+	metrics.RecordAPIUsage(h.Storyteller.Name(), 0, time.Since(startTime), false)
+	metrics.RecordError("ai_api_failure", fmt.Sprintf("%s (status %d): %v", aiErr.Type, aiErr.StatusCode, err))
+
+	// Keep the story going offline when the provider is down rather than refusing the request
+	if shouldUseFallback(aiErr) && sess.GameState.Environment.LocationName != "" {
+		// The offline engine plays by its own rules, so the turn's roll and recipe are dropped.
+		sess.TurnCheck, sess.TurnCraft = nil, nil
+		engine := &OfflineEngine{Rooms: sess.KnownRooms}
+		fallbackResponse := engine.Play(sess.GameState, userAction)
+		sess.KnownRooms = engine.Rooms
+		// The offline engine spends stamina itself, so only the conditions tick.
+		items := story.SettleItems(sess.GameState, fallbackResponse.NewGameState, userAction, nil)
+		fallbackResponse = settleTurn(sess, fallbackResponse, story.TickConditions(sess.GameState, fallbackResponse.NewGameState), items)
+		metrics.RecordStoryGeneration(time.Since(startTime), sess.CurrentGenre, sess.GameState.Rules.ConsequenceModel, true)
+
+		fallbackMessage := GetFallbackErrorMessage()
+		storyText := fallbackMessage + "\n\n" + sanitizeStoryText(fallbackResponse.StoryUpdate.Story)
+
+		before := sess.GameState
+		changes := story.Diff(before, fallbackResponse.NewGameState)
+		sess.GameState = fallbackResponse.NewGameState
+		sess.StoryHistory = append(sess.StoryHistory, story.StoryPage{Prompt: userAction, Response: storyText, Changes: changes, State: sess.GameState.Clone()})
+		rememberRoom(sess)
+		recordJournal(sess, before, changes, storyText)
+
+		templates.Update(sess.StoryHistory, sess.GameState.PlayerStatus, sess.GameState.Inventory, fallbackResponse.StoryUpdate.BackgroundColor, fallbackResponse.StoryUpdate.GameOver, sess.GameState.GameWon, sess.CurrentGenre, sess.GameState.Rules.ConsequenceModel, sess.GameState.World.WorldTension, sess.CurrentAuthor, sess.TotalTokens, sess.WorldMap, journalView(sess), canRewind(sess)).Render(r.Context(), w)
+		return
 	}
 
 	// Fall back to regular error handling
-	friendlyError := getUserFriendlyError(err, ErrorTypeAI)
+	friendlyError := getUserFriendlyError(aiErr, aiErr.Type)
 	errorPage := createErrorPage(userAction, friendlyError)
 
 	sess.StoryHistory = append(sess.StoryHistory, errorPage)
-	templates.Update(sess.StoryHistory, sess.GameState.PlayerStatus, sess.GameState.Inventory, "#1e1e1e", false, false, sess.CurrentGenre, sess.GameState.Rules.ConsequenceModel, sess.GameState.World.WorldTension, sess.CurrentAuthor).Render(r.Context(), w)
+	templates.Update(sess.StoryHistory, sess.GameState.PlayerStatus, sess.GameState.Inventory, "#1e1e1e", false, false, sess.CurrentGenre, sess.GameState.Rules.ConsequenceModel, sess.GameState.World.WorldTension, sess.CurrentAuthor, sess.TotalTokens, sess.WorldMap, journalView(sess), canRewind(sess)).Render(r.Context(), w)
 }
 
-// shouldUseFallback determines if we should try fallback generation
+// shouldUseFallback determines if we should try fallback generation: the provider is
+// unreachable, failing, overloaded or too slow, or the circuit breaker has stopped
+// calling it, as opposed to refusing or misreading this request.
 func shouldUseFallback(err error) bool {
-	errMsg := strings.ToLower(err.Error())
-
-	// Use fallback for network issues, quota limits, or service unavailable
-	return strings.Contains(errMsg, "quota") ||
-		strings.Contains(errMsg, "network") ||
-		strings.Contains(errMsg, "timeout") ||
-		strings.Contains(errMsg, "unavailable") ||
-		strings.Contains(errMsg, "rate limit") ||
-		strings.Contains(errMsg, "temporarily")
+	if errors.Is(err, errCircuitOpen) {
+		return true
+	}
+	switch class := classifyAIError(err); class.Type {
+	case ErrorTypeNetwork, ErrorTypeTimeout, ErrorTypeRateLimit:
+		return true
+	case ErrorTypeAI:
+		return class.StatusCode >= 500
+	}
+	return false
 }
 
 // handleValidationError handles validation errors
@@ -223,7 +275,7 @@ func handleValidationError(w http.ResponseWriter, r *http.Request, sess *session
 	errorPage := createErrorPage(userAction, friendlyError)
 
 	sess.StoryHistory = append(sess.StoryHistory, errorPage)
-	templates.Update(sess.StoryHistory, sess.GameState.PlayerStatus, sess.GameState.Inventory, "#1e1e1e", false, false, sess.CurrentGenre, sess.GameState.Rules.ConsequenceModel, sess.GameState.World.WorldTension, sess.CurrentAuthor).Render(r.Context(), w)
+	templates.Update(sess.StoryHistory, sess.GameState.PlayerStatus, sess.GameState.Inventory, "#1e1e1e", false, false, sess.CurrentGenre, sess.GameState.Rules.ConsequenceModel, sess.GameState.World.WorldTension, sess.CurrentAuthor, sess.TotalTokens, sess.WorldMap, journalView(sess), canRewind(sess)).Render(r.Context(), w)
 }
 
 // handleSystemError handles system-level errors
@@ -234,7 +286,7 @@ func handleSystemError(w http.ResponseWriter, r *http.Request, sess *session.Ses
 	errorPage := createErrorPage(userAction, friendlyError)
 
 	sess.StoryHistory = append(sess.StoryHistory, errorPage)
-	templates.Update(sess.StoryHistory, sess.GameState.PlayerStatus, sess.GameState.Inventory, "#1e1e1e", false, false, sess.CurrentGenre, sess.GameState.Rules.ConsequenceModel, sess.GameState.World.WorldTension, sess.CurrentAuthor).Render(r.Context(), w)
+	templates.Update(sess.StoryHistory, sess.GameState.PlayerStatus, sess.GameState.Inventory, "#1e1e1e", false, false, sess.CurrentGenre, sess.GameState.Rules.ConsequenceModel, sess.GameState.World.WorldTension, sess.CurrentAuthor, sess.TotalTokens, sess.WorldMap, journalView(sess), canRewind(sess)).Render(r.Context(), w)
 }
 
 // handleStartStoryError handles errors during initial story generation
@@ -251,8 +303,11 @@ func handleStartStoryError(w http.ResponseWriter, r *http.Request, err error, er
 			</div>
 			<button onclick="window.location.reload()">Try Again</button>
 		</div>
-	`, getRandomErrorResponse(friendlyError.Message), friendlyError.Suggestion,
+	`, getRandomErrorResponse(html.EscapeString(friendlyError.Message)), html.EscapeString(friendlyError.Suggestion),
 		func() string {
+			if friendlyError.CanRetry && friendlyError.RetryAfter > 0 {
+				return fmt.Sprintf(`<p><em>You can try again in %d seconds by refreshing the page.</em></p>`, int(math.Ceil(friendlyError.RetryAfter.Seconds())))
+			}
 			if friendlyError.CanRetry {
 				return `<p><em>You can try again by refreshing the page.</em></p>`
 			}
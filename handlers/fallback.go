@@ -3,130 +3,645 @@ package handlers
 import (
 	"fmt"
 	"math/rand"
+	"slices"
+	"story_ai/session"
 	"story_ai/story"
-	"time"
+	"strings"
 )
 
-// FallbackStoryGenerator provides basic story generation when AI is unavailable
-type FallbackStoryGenerator struct{}
+// OfflineEngine continues the current story without a model. It interprets simple
+// verbs (go, take, drop, use, look, talk) against the game state and applies a few
+// property rules, so the player can keep playing until the storyteller is back.
+type OfflineEngine struct {
+	Rooms map[string]story.Environment // Rooms seen earlier in the story, by location name
+}
 
-// GenerateFallbackStory creates a simple story when AI fails
-func (f *FallbackStoryGenerator) GenerateFallbackStory(genre, author string) (AIResponse, error) {
-	rand.Seed(time.Now().UnixNano())
+// Stamina costs and gains for offline actions.
+const (
+	offlineMoveCost  = 5
+	offlineHeavyCost = 10
+	offlineLiftCost  = 15
+	offlineRestGain  = 20
+	offlineFoodGain  = 25
+	offlineHealGain  = 20
+)
 
-	storyTemplates := map[string][]string{
-		"fantasy": {
-			"You find yourself in a mystical forest where ancient trees whisper secrets of old. A glowing sword calls to you from a nearby pedestal. As you approach, you hear the voice of %s echoing through the woods: 'Choose wisely, adventurer, for this blade holds great power.'",
-			"In the kingdom of Eldoria, you discover an ancient prophecy hidden in the royal library. The words speak of a hero who will rise when darkness threatens the land. As you read the final passage, thunder rumbles outside. %s appears before you, eyes gleaming with ancient wisdom.",
-			"The dragon's lair is filled with glittering treasures, but as you reach for a golden chalice, you hear a voice: 'Foolish mortal,' says %s, the ancient guardian. 'You have trespassed in my domain. What bargain do you offer for your life?'",
-		},
-		"sci-fi": {
-			"The starship's AI core begins to glow with an otherworldly light. 'Warning: Unknown energy signature detected,' announces the computer. Suddenly, %s materializes in the control room, their form shifting between solid and energy states.",
-			"On the distant planet of Zorath-7, you discover an ancient alien artifact buried beneath the red sands. As you brush away the dirt, holographic images appear showing %s, a legendary explorer from a long-extinct civilization.",
-			"The hyperspace jump goes wrong, and you find yourself in a pocket dimension. Floating before you is %s, an entity composed entirely of quantum fluctuations. 'You have entered the space between spaces,' it intones.",
-		},
-		"historical-fiction": {
-			"The year is 1347, and the Black Death has just arrived in your village. As you tend to the sick, you meet %s, a mysterious healer with knowledge that seems to come from beyond your time. 'I can teach you ways to fight this plague,' they whisper.",
-			"In the court of King Arthur, you discover a hidden chamber beneath the Round Table. There, illuminated by torchlight, stands %s, a figure from the mists of legend. 'The old ways are fading,' they say. 'Will you help preserve them?'",
-			"During the Renaissance in Florence, you stumble upon a secret society meeting in the catacombs beneath the city. At the center stands %s, their eyes reflecting the wisdom of ages past. 'Art and science shall change the world,' they proclaim.",
-		},
+// offlineVerbs maps the words a player might type to the engine's verbs.
+var offlineVerbs = map[string]string{
+	"go": "go", "walk": "go", "run": "go", "move": "go", "head": "go", "enter": "go", "climb": "go", "travel": "go",
+	"take": "take", "get": "take", "grab": "take", "pick": "take", "collect": "take",
+	"drop": "drop", "discard": "drop", "leave": "drop",
+	"use": "use", "light": "light", "burn": "light", "ignite": "light", "open": "open", "unlock": "open",
+	"eat": "use", "drink": "use", "cut": "cut",
+	"look": "look", "examine": "look", "inspect": "look", "search": "look", "l": "look", "x": "look",
+	"talk": "talk", "speak": "talk", "ask": "talk", "greet": "talk",
+	"inventory": "inventory", "inv": "inventory", "i": "inventory",
+	"rest": "rest", "wait": "rest", "sleep": "rest",
+}
+
+// offlineOpposites lets the engine add a way back to rooms it has to invent.
+var offlineOpposites = map[string]string{
+	"north": "south", "south": "north", "east": "west", "west": "east",
+	"northeast": "southwest", "southwest": "northeast", "northwest": "southeast", "southeast": "northwest",
+	"up": "down", "down": "up", "in": "out", "out": "in",
+}
+
+var offlineDirectionAliases = map[string]string{
+	"n": "north", "s": "south", "e": "east", "w": "west",
+	"ne": "northeast", "nw": "northwest", "se": "southeast", "sw": "southwest",
+	"u": "up", "d": "down",
+}
+
+// offlineFillerWords are ignored when matching the object of a sentence.
+var offlineFillerWords = map[string]bool{"the": true, "a": true, "an": true, "up": true, "to": true, "at": true, "around": true, "down": true, "my": true, "some": true, "with": true}
+
+// Properties that the offline rules understand.
+var (
+	fireProps      = []string{"fire", "flame", "burning", "lit", "hot"}
+	immovableProps = []string{"fixed", "immovable", "huge", "stone", "furniture"}
+	keyProps       = []string{"key"}
+	sharpProps     = []string{"sharp", "blade", "cutting"}
+	cuttableProps  = []string{"rope", "tied", "bound", "web", "cloth"}
+	foodProps      = []string{"edible", "food", "drink"}
+	healingProps   = []string{"healing", "medicine", "potion", "restorative"}
+	fragileProps   = []string{"fragile", "breakable", "glass"}
+)
+
+// Play applies the player's action to a copy of state and narrates the result.
+func (e *OfflineEngine) Play(state *story.GameState, action string) AIResponse {
+	next := state.Clone()
+	turn := &offlineTurn{engine: e, state: next}
+
+	verb, object, target := parseOfflineAction(action)
+	switch verb {
+	case "go":
+		turn.goTo(object)
+	case "take":
+		turn.take(object)
+	case "drop":
+		turn.drop(object)
+	case "use":
+		turn.use(object, target)
+	case "light":
+		turn.applyTo(target, object, fireProps, "light")
+	case "open":
+		turn.applyTo(target, object, keyProps, "open")
+	case "cut":
+		turn.applyTo(target, object, sharpProps, "cut")
+	case "look":
+		turn.look(object)
+	case "talk":
+		turn.talk(object)
+	case "inventory":
+		turn.inventory()
+	case "rest":
+		turn.rest()
+	default:
+		turn.say("Without the storyteller, the world only answers simple actions: <strong>go</strong>, <strong>take</strong>, <strong>drop</strong>, <strong>use</strong>, <strong>look</strong> and <strong>talk</strong>.")
 	}
 
-	templates, exists := storyTemplates[genre]
-	if !exists {
-		templates = storyTemplates["fantasy"] // Default to fantasy
-	}
-
-	selectedTemplate := templates[rand.Intn(len(templates))]
-	storyText := fmt.Sprintf(selectedTemplate, author)
-
-	response := AIResponse{
-		NewGameState: &story.GameState{
-			PlayerStatus: story.PlayerStatus{
-				Health:     100,
-				Stamina:    100,
-				Conditions: []string{},
-			},
-			Inventory: []story.Item{
-				{
-					Name:        "mysterious amulet",
-					Description: "a glowing pendant that hums with inner light",
-					Properties:  []string{"magical"},
-					State:       "equipped",
-				},
-			},
-			Environment: story.Environment{
-				LocationName: "Mysterious Chamber",
-				Description:  "A dimly lit chamber filled with ancient artifacts and glowing runes.",
-				Exits:        map[string]string{"north": "Dark Corridor", "east": "Treasure Room"},
-				WorldObjects: []story.WorldObject{
-					{Name: "ancient pedestal", Properties: []string{"stone", "carved"}, State: "stable"},
-					{Name: "glowing runes", Properties: []string{"magical", "ancient"}, State: "glowing"},
-				},
-			},
-			NPCs: []story.NPC{
-				{
-					Name:        author,
-					Disposition: "neutral",
-					Knowledge:   []string{"knows_about_ancient_secrets"},
-					Goal:        "Guide the adventurer",
-				},
-			},
-			Puzzles: []story.Puzzle{
-				{
-					Name:          "Ancient Riddle",
-					Type:          "logic",
-					Description:   "Decipher the meaning of the glowing runes",
-					Status:        "unsolved",
-					SolutionHints: []string{"look_closely", "think_about_symbols"},
-				},
-			},
-			ProperNouns: []story.ProperNoun{
-				{
-					Noun:        author,
-					PhraseUsed:  author,
-					Description: "a mysterious figure with ancient knowledge",
-				},
-			},
-			World: story.World{
-				WorldTension: 25,
-			},
-			Rules: story.Rules{
-				ConsequenceModel: "challenging",
-			},
-			Climax: false,
-			WinConditions: []string{
-				"Solve the ancient riddle",
-				"Escape the chamber safely",
-			},
-			LossConditions: []string{
-				"Trigger the chamber's traps",
-				"Offend the guardian spirit",
-			},
-			GameWon:           false,
-			GameLost:          false,
-			SolvedPuzzleTypes: []string{},
-		},
+	return AIResponse{
+		NewGameState: next,
 		StoryUpdate: StoryUpdate{
-			Story:           storyText,
-			ItemsAdded:      []string{"mysterious amulet"},
-			ItemsRemoved:    []string{},
-			GameOver:        false,
-			BackgroundColor: "#2d1b69",
+			Story:           strings.Join(turn.lines, " "),
+			ItemsAdded:      turn.added,
+			ItemsRemoved:    turn.removed,
+			GameOver:        next.PlayerStatus.Health <= 0,
+			BackgroundColor: "#1e1e1e",
 		},
 	}
+}
+
+// parseOfflineAction splits an action into a verb, its object and an optional target
+// ("use the torch on the curtains" gives use, torch, curtains). A bare direction is a "go".
+func parseOfflineAction(action string) (string, string, string) {
+	words := strings.Fields(strings.ToLower(strings.Trim(action, ".!? ")))
+	if len(words) == 0 {
+		return "look", "", ""
+	}
+	if _, ok := offlineOpposites[normalizeDirection(words[0])]; ok && len(words) == 1 {
+		return "go", words[0], ""
+	}
+
+	verb, ok := offlineVerbs[words[0]]
+	if !ok {
+		return "", "", ""
+	}
+	rest := words[1:]
+	if verb == "go" {
+		// Directions such as "up" and "down" are filler elsewhere but matter here.
+		rest = slices.DeleteFunc(rest, func(w string) bool { return w == "the" || w == "to" || w == "a" || w == "an" })
+		return verb, strings.Join(rest, " "), ""
+	}
+
+	// "light the torch with the fire" is the same as "use fire on the torch"; the first
+	// noun is the thing being changed.
+	for i, word := range rest {
+		if word == "on" || word == "with" || word == "into" || word == "using" || word == "at" && i > 0 {
+			first, second := offlinePhrase(rest[:i]), offlinePhrase(rest[i+1:])
+			if verb == "light" || verb == "open" || verb == "cut" {
+				return verb, second, first
+			}
+			return verb, first, second
+		}
+	}
+	if verb == "light" || verb == "open" || verb == "cut" {
+		return verb, "", offlinePhrase(rest)
+	}
+	return verb, offlinePhrase(rest), ""
+}
+
+func offlinePhrase(words []string) string {
+	var kept []string
+	for _, w := range words {
+		if !offlineFillerWords[w] {
+			kept = append(kept, w)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+func normalizeDirection(word string) string {
+	if full, ok := offlineDirectionAliases[word]; ok {
+		return full
+	}
+	return word
+}
+
+// offlineTurn collects the narration and item changes for one offline action.
+type offlineTurn struct {
+	engine  *OfflineEngine
+	state   *story.GameState
+	lines   []string
+	added   []string
+	removed []string
+}
 
-	return response, nil
+func (t *offlineTurn) say(format string, args ...any) {
+	t.lines = append(t.lines, fmt.Sprintf(format, args...))
+}
+
+func (t *offlineTurn) goTo(where string) {
+	env := &t.state.Environment
+	if where == "" {
+		t.say("Go where? %s", describeExits(env.Exits))
+		return
+	}
+
+	direction, destination := "", ""
+	for dir, dest := range env.Exits {
+		if normalizeDirection(where) == dir || matchesName(where, dest) {
+			direction, destination = dir, dest
+			break
+		}
+	}
+	if destination == "" {
+		t.say("You can't go that way. %s", describeExits(env.Exits))
+		return
+	}
+
+	cost := offlineMoveCost
+	for _, item := range t.state.Inventory {
+		if hasAnyProperty(item.Properties, "heavy") {
+			cost += offlineHeavyCost
+		}
+	}
+	if t.state.PlayerStatus.Stamina < cost {
+		t.say("You are too exhausted to go on while carrying so much. Rest, or drop something heavy.")
+		return
+	}
+	t.state.PlayerStatus.Stamina -= cost
+
+	t.engine.remember(*env)
+	previous := env.LocationName
+	if known, ok := t.engine.Rooms[destination]; ok {
+		*env = known.Clone()
+		t.say("You make your way %s, back to <strong>%s</strong>.", direction, destination)
+		t.say("%s", env.Description)
+	} else {
+		*env = story.Environment{
+			LocationName: destination,
+			Description:  "You have not been here before, and without the storyteller its details stay hazy.",
+			Exits:        map[string]string{},
+		}
+		if back, ok := offlineOpposites[direction]; ok {
+			env.Exits[back] = previous
+		}
+		t.say("You make your way %s into <strong>%s</strong>. %s", direction, destination, env.Description)
+	}
+	if cost > offlineMoveCost {
+		t.say("Your load makes the going slow and tiring.")
+	}
+	t.engine.remember(*env)
+}
+
+func (t *offlineTurn) take(what string) {
+	if what == "" {
+		t.say("Take what?")
+		return
+	}
+	if i := findObject(t.state.Environment.WorldObjects, what); i >= 0 {
+		obj := t.state.Environment.WorldObjects[i]
+		if hasAnyProperty(obj.Properties, immovableProps...) {
+			t.say("The <strong>%s</strong> won't budge.", obj.Name)
+			return
+		}
+		if hasAnyProperty(obj.Properties, "heavy") {
+			for _, item := range t.state.Inventory {
+				if hasAnyProperty(item.Properties, "heavy") {
+					t.say("You are already carrying the <strong>%s</strong>; you can't manage another heavy load.", item.Name)
+					return
+				}
+			}
+			if t.state.PlayerStatus.Stamina < offlineLiftCost {
+				t.say("You strain at the <strong>%s</strong>, but you are too tired to lift it.", obj.Name)
+				return
+			}
+			t.state.PlayerStatus.Stamina -= offlineLiftCost
+		}
+
+		t.state.Environment.WorldObjects = slices.Delete(t.state.Environment.WorldObjects, i, i+1)
+		t.state.Inventory = append(t.state.Inventory, story.Item{
+			Name:        obj.Name,
+			Description: describeProperties(obj.Name, obj.Properties),
+			Properties:  obj.Properties,
+			State:       obj.State,
+		})
+		t.added = append(t.added, obj.Name)
+		if hasAnyProperty(obj.Properties, "heavy") {
+			t.say("With some effort you heave up the <strong>%s</strong>.", obj.Name)
+		} else {
+			t.say("You take the <strong>%s</strong>.", obj.Name)
+		}
+		return
+	}
+	if findItem(t.state.Inventory, what) >= 0 {
+		t.say("You already have that.")
+		return
+	}
+	t.say("You don't see any %s here.", what)
+}
+
+func (t *offlineTurn) drop(what string) {
+	i := findItem(t.state.Inventory, what)
+	if i < 0 {
+		t.say("You aren't carrying that.")
+		return
+	}
+	item := t.state.Inventory[i]
+	t.state.Inventory = slices.Delete(t.state.Inventory, i, i+1)
+	t.state.Environment.WorldObjects = append(t.state.Environment.WorldObjects, story.WorldObject{
+		Name:       item.Name,
+		Properties: item.Properties,
+		State:      item.State,
+	})
+	t.removed = append(t.removed, item.Name)
+	if hasAnyProperty(item.Properties, fragileProps...) {
+		t.state.Environment.WorldObjects[len(t.state.Environment.WorldObjects)-1].State = "broken"
+		t.say("The <strong>%s</strong> slips from your hands and shatters.", item.Name)
+		return
+	}
+	t.say("You set down the <strong>%s</strong>.", item.Name)
+}
+
+// use handles "use X" and "use X on Y".
+func (t *offlineTurn) use(what, target string) {
+	i := findItem(t.state.Inventory, what)
+	if i < 0 {
+		if target == "" && findObject(t.state.Environment.WorldObjects, what) >= 0 {
+			t.say("You fiddle with the %s, but nothing comes of it.", what)
+			return
+		}
+		t.say("You aren't carrying any %s.", what)
+		return
+	}
+	item := &t.state.Inventory[i]
+
+	if target != "" {
+		t.useOn(item, target)
+		return
+	}
+
+	switch {
+	case hasAnyProperty(item.Properties, healingProps...):
+		t.state.PlayerStatus.Health = min(story.MaxHealth, t.state.PlayerStatus.Health+offlineHealGain)
+		t.consume(i, "You use the <strong>%s</strong> and feel your wounds ease.")
+	case hasAnyProperty(item.Properties, foodProps...):
+		t.state.PlayerStatus.Stamina = min(story.MaxStamina, t.state.PlayerStatus.Stamina+offlineFoodGain)
+		t.consume(i, "You finish the <strong>%s</strong> and feel some strength return.")
+	case hasAnyProperty(item.Properties, fireProps...):
+		t.say("The <strong>%s</strong> throws flickering light across %s.", item.Name, t.state.Environment.LocationName)
+	default:
+		t.say("You turn the <strong>%s</strong> over in your hands. It needs something to be used on.", item.Name)
+	}
+}
+
+func (t *offlineTurn) consume(i int, format string) {
+	name := t.state.Inventory[i].Name
+	t.state.Inventory = slices.Delete(t.state.Inventory, i, i+1)
+	t.removed = append(t.removed, name)
+	t.say(format, name)
+}
+
+// useOn applies an inventory item to an object in the room or another carried item.
+func (t *offlineTurn) useOn(item *story.Item, target string) {
+	objIdx := findObject(t.state.Environment.WorldObjects, target)
+	var name string
+	var props *[]string
+	var state *string
+	switch {
+	case objIdx >= 0:
+		obj := &t.state.Environment.WorldObjects[objIdx]
+		name, props, state = obj.Name, &obj.Properties, &obj.State
+	case findItem(t.state.Inventory, target) >= 0:
+		other := &t.state.Inventory[findItem(t.state.Inventory, target)]
+		name, props, state = other.Name, &other.Properties, &other.State
+	default:
+		t.say("You don't see any %s here.", target)
+		return
+	}
+
+	switch {
+	case hasAnyProperty(item.Properties, fireProps...) && hasAnyProperty(*props, "flammable"):
+		if objIdx < 0 {
+			// A carried item set alight becomes a light source.
+			*state = "lit"
+			*props = append(removeProperty(*props, "flammable"), "lit")
+			t.say("The <strong>%s</strong> catches and burns steadily.", name)
+			return
+		}
+		*state = "burnt"
+		*props = removeProperty(*props, "flammable")
+		t.state.World.WorldTension = min(story.MaxTension, t.state.World.WorldTension+5)
+		t.say("You touch the <strong>%s</strong> to the <strong>%s</strong>. It catches at once and burns down to blackened ruin, filling the air with smoke.", item.Name, name)
+	case hasAnyProperty(*props, fireProps...) && hasAnyProperty(item.Properties, "flammable"):
+		item.State = "lit"
+		item.Properties = append(removeProperty(item.Properties, "flammable"), "lit")
+		t.say("You hold the <strong>%s</strong> to the <strong>%s</strong> until it catches.", item.Name, name)
+	case (hasAnyProperty(item.Properties, keyProps...) || strings.Contains(strings.ToLower(item.Name), "key")) && (*state == "locked" || hasAnyProperty(*props, "locked")):
+		*state = "unlocked"
+		*props = removeProperty(*props, "locked")
+		t.say("The <strong>%s</strong> turns with a click. The <strong>%s</strong> is unlocked.", item.Name, name)
+	case hasAnyProperty(item.Properties, sharpProps...) && hasAnyProperty(*props, cuttableProps...):
+		*state = "cut"
+		t.say("You saw through the <strong>%s</strong> with the <strong>%s</strong>.", name, item.Name)
+	case hasAnyProperty(item.Properties, "heavy") && hasAnyProperty(*props, fragileProps...):
+		*state = "broken"
+		t.say("You bring the <strong>%s</strong> down on the <strong>%s</strong>, which breaks apart.", item.Name, name)
+	default:
+		t.say("You try the <strong>%s</strong> on the <strong>%s</strong>, but nothing happens.", item.Name, name)
+	}
+}
+
+// applyTo handles verbs that name the thing being changed ("light the torch", "open the
+// chest"), finding a carried item with one of the needed properties to do it with.
+func (t *offlineTurn) applyTo(target, with string, toolProps []string, verb string) {
+	if target == "" {
+		t.say("%s what?", strings.ToUpper(verb[:1])+verb[1:])
+		return
+	}
+	if with != "" {
+		t.use(with, target)
+		return
+	}
+	for _, item := range t.state.Inventory {
+		isKey := verb == "open" && strings.Contains(strings.ToLower(item.Name), "key")
+		if (hasAnyProperty(item.Properties, toolProps...) || isKey) && !matchesName(target, item.Name) {
+			t.use(item.Name, target)
+			return
+		}
+	}
+	// Fire in the room can light a carried item too.
+	if verb == "light" {
+		for _, obj := range t.state.Environment.WorldObjects {
+			if hasAnyProperty(obj.Properties, fireProps...) && findItem(t.state.Inventory, target) >= 0 {
+				t.use(target, obj.Name)
+				return
+			}
+		}
+	}
+	t.say("You have nothing to %s it with.", verb)
+}
+
+func (t *offlineTurn) look(what string) {
+	env := t.state.Environment
+	if what == "" || what == "room" || matchesName(what, env.LocationName) {
+		t.say("<strong>%s</strong>. %s", env.LocationName, env.Description)
+		if len(env.WorldObjects) > 0 {
+			var names []string
+			for _, obj := range env.WorldObjects {
+				names = append(names, describeObject(obj.Name, obj.State))
+			}
+			t.say("You see %s.", joinNames(names))
+		}
+		if len(t.state.NPCs) > 0 {
+			var names []string
+			for _, npc := range t.state.NPCs {
+				names = append(names, "<strong>"+npc.Name+"</strong>")
+			}
+			t.say("%s %s here.", joinNames(names), pluralVerb(len(names)))
+		}
+		t.say("%s", describeExits(env.Exits))
+		return
+	}
+	if i := findItem(t.state.Inventory, what); i >= 0 {
+		item := t.state.Inventory[i]
+		t.say("The <strong>%s</strong>: %s", item.Name, item.Description)
+		return
+	}
+	if i := findObject(env.WorldObjects, what); i >= 0 {
+		obj := env.WorldObjects[i]
+		details := slices.DeleteFunc(slices.Concat(obj.Properties, []string{obj.State}), func(p string) bool { return p == "" })
+		if len(details) == 0 {
+			t.say("There is nothing remarkable about the <strong>%s</strong>.", obj.Name)
+			return
+		}
+		t.say("The <strong>%s</strong> looks %s.", obj.Name, joinNames(details))
+		return
+	}
+	if i := findNPC(t.state.NPCs, what); i >= 0 {
+		npc := t.state.NPCs[i]
+		t.say("<strong>%s</strong> seems %s.", npc.Name, orDefault(npc.Disposition, "hard to read"))
+		return
+	}
+	t.say("You don't see any %s here.", what)
+}
+
+func (t *offlineTurn) talk(who string) {
+	if len(t.state.NPCs) == 0 {
+		t.say("There is no one here to talk to.")
+		return
+	}
+	i := findNPC(t.state.NPCs, who)
+	if i < 0 {
+		if who != "" {
+			t.say("You don't see %s here.", who)
+			return
+		}
+		i = 0
+	}
+	npc := t.state.NPCs[i]
+	disposition := strings.ToLower(npc.Disposition)
+	switch {
+	case strings.Contains(disposition, "hostile") || strings.Contains(disposition, "angry"):
+		t.state.World.WorldTension = min(story.MaxTension, t.state.World.WorldTension+5)
+		t.say("<strong>%s</strong> glares at you and refuses to answer.", npc.Name)
+	case (strings.Contains(disposition, "friend") || strings.Contains(disposition, "help") || strings.Contains(disposition, "ally")) && len(npc.Knowledge) > 0:
+		fact := npc.Knowledge[rand.Intn(len(npc.Knowledge))]
+		t.say("<strong>%s</strong> leans in and tells you something: %s.", npc.Name, strings.ReplaceAll(fact, "_", " "))
+	case npc.Goal != "":
+		t.say("<strong>%s</strong> listens, but seems preoccupied: %s.", npc.Name, strings.ToLower(strings.TrimSuffix(npc.Goal, ".")))
+	default:
+		t.say("<strong>%s</strong> listens, but says little.", npc.Name)
+	}
+}
+
+func (t *offlineTurn) inventory() {
+	if len(t.state.Inventory) == 0 {
+		t.say("You are carrying nothing.")
+		return
+	}
+	var names []string
+	for _, item := range t.state.Inventory {
+		names = append(names, describeObject(item.Name, item.State))
+	}
+	t.say("You are carrying %s.", joinNames(names))
+}
+
+func (t *offlineTurn) rest() {
+	t.state.PlayerStatus.Stamina = min(story.MaxStamina, t.state.PlayerStatus.Stamina+offlineRestGain)
+	t.say("You rest a while and catch your breath.")
+}
+
+// remember records a room so that returning to it offline restores what was there.
+func (e *OfflineEngine) remember(env story.Environment) {
+	if env.LocationName == "" {
+		return
+	}
+	if e.Rooms == nil {
+		e.Rooms = make(map[string]story.Environment)
+	}
+	e.Rooms[env.LocationName] = env.Clone()
+}
+
+// rememberRoom records the session's current room for the offline engine and the world map.
+func rememberRoom(sess *session.Session) {
+	engine := &OfflineEngine{Rooms: sess.KnownRooms}
+	engine.remember(sess.GameState.Environment)
+	sess.KnownRooms = engine.Rooms
+	if sess.WorldMap == nil {
+		sess.WorldMap = &story.WorldMap{}
+	}
+	sess.WorldMap.Visit(sess.GameState.Environment)
+}
+
+// matchesName reports whether a phrase the player typed refers to name.
+func matchesName(phrase, name string) bool {
+	phrase, name = strings.ToLower(strings.TrimSpace(phrase)), strings.ToLower(name)
+	if phrase == "" {
+		return false
+	}
+	if phrase == name || strings.Contains(name, phrase) || strings.Contains(phrase, name) {
+		return true
+	}
+	for _, word := range strings.Fields(phrase) {
+		if len(word) > 2 && slices.Contains(strings.Fields(name), word) {
+			return true
+		}
+	}
+	return false
+}
+
+func findObject(objects []story.WorldObject, phrase string) int {
+	return slices.IndexFunc(objects, func(o story.WorldObject) bool { return matchesName(phrase, o.Name) })
+}
+
+func findItem(items []story.Item, phrase string) int {
+	return slices.IndexFunc(items, func(i story.Item) bool { return matchesName(phrase, i.Name) })
+}
+
+func findNPC(npcs []story.NPC, phrase string) int {
+	return slices.IndexFunc(npcs, func(n story.NPC) bool { return matchesName(phrase, n.Name) })
+}
+
+func hasAnyProperty(props []string, wanted ...string) bool {
+	for _, p := range props {
+		if slices.Contains(wanted, strings.ToLower(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+func removeProperty(props []string, unwanted string) []string {
+	return slices.DeleteFunc(slices.Clone(props), func(p string) bool { return strings.EqualFold(p, unwanted) })
+}
+
+func describeExits(exits map[string]string) string {
+	if len(exits) == 0 {
+		return "There is no obvious way out."
+	}
+	dirs := make([]string, 0, len(exits))
+	for dir := range exits {
+		dirs = append(dirs, dir)
+	}
+	slices.Sort(dirs)
+	return fmt.Sprintf("Exits lead %s.", joinNames(dirs))
+}
+
+func describeObject(name, state string) string {
+	if state == "" {
+		return "a <strong>" + name + "</strong>"
+	}
+	return fmt.Sprintf("a <strong>%s</strong> (%s)", name, state)
+}
+
+func describeProperties(name string, props []string) string {
+	var kept []string
+	for _, p := range props {
+		if p != "" {
+			kept = append(kept, strings.ReplaceAll(p, "_", " "))
+		}
+	}
+	if len(kept) == 0 {
+		return "an unremarkable " + name
+	}
+	return "a " + strings.Join(kept, ", ") + " " + name
+}
+
+func joinNames(names []string) string {
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0]
+	default:
+		return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+	}
+}
+
+func pluralVerb(n int) string {
+	if n == 1 {
+		return "is"
+	}
+	return "are"
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
 }
 
 // GetFallbackErrorMessage returns a user-friendly message when fallback is used
 func GetFallbackErrorMessage() string {
 	messages := []string{
-		"🤖 The main story generator is currently unavailable, but here's a backup tale!",
-		"📖 The AI storyteller is taking a break, but I've prepared a simple adventure!",
-		"🌟 The advanced generator is offline, but enjoy this classic tale!",
-		"⚔️ The primary storyteller is resting, but here's a simple quest!",
-		"🏰 The main generator is updating, but here's a basic adventure!",
+		"🤖 The main story generator is currently unavailable, so the world answers simply for now.",
+		"📖 The AI storyteller is taking a break; simple actions still work until it returns.",
+		"🌟 The advanced generator is offline, but your story carries on in plain words.",
+		"⚔️ The primary storyteller is resting; you can still go, take, use, look and talk.",
+		"🏰 The main generator is updating, but your adventure continues in the meantime.",
 	}
 
 	return messages[rand.Intn(len(messages))]
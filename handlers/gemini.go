@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+)
+
+// DefaultGeminiModel is the Gemini model used when none is configured.
+const DefaultGeminiModel = "gemini-3.1-flash-lite-preview"
+
+// GeminiStoryteller is a Storyteller backed by the Google Gemini API.
+type GeminiStoryteller struct {
+	client    *genai.Client
+	modelName string
+}
+
+// NewGeminiStoryteller creates a Storyteller that talks to the given Gemini model.
+func NewGeminiStoryteller(client *genai.Client, modelName string) *GeminiStoryteller {
+	if modelName == "" {
+		modelName = DefaultGeminiModel
+	}
+	return &GeminiStoryteller{
+		client:    client,
+		modelName: modelName,
+	}
+}
+
+// Name returns the provider name used in metrics.
+func (g *GeminiStoryteller) Name() string {
+	return "gemini"
+}
+
+// Tell sends the marshalled AIRequest to Gemini.
+func (g *GeminiStoryteller) Tell(ctx context.Context, systemPrompt string, req AIRequest) (StorytellerResponse, error) {
+	reqText, err := marshalAIRequest(req)
+	if err != nil {
+		return StorytellerResponse{}, err
+	}
+	return g.generate(ctx, systemPrompt, reqText)
+}
+
+// TellStream sends the marshalled AIRequest to Gemini and reports the text as it streams in.
+func (g *GeminiStoryteller) TellStream(ctx context.Context, systemPrompt string, req AIRequest, onText func(raw string)) (StorytellerResponse, error) {
+	reqText, err := marshalAIRequest(req)
+	if err != nil {
+		return StorytellerResponse{}, err
+	}
+
+	// Without a schema, so the story streams first; see model.
+	iter := g.model(systemPrompt, false).GenerateContentStream(ctx, genai.Text(reqText))
+	var text strings.Builder
+	var usage TokenUsage
+	for {
+		resp, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			// The tokens streamed so far are still billed.
+			return StorytellerResponse{Usage: usage}, err
+		}
+
+		// Usage metadata is cumulative; the last chunk carries the final totals.
+		if resp.UsageMetadata != nil {
+			usage = geminiUsage(resp)
+		}
+		if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+			continue
+		}
+		for _, part := range resp.Candidates[0].Content.Parts {
+			if t, ok := part.(genai.Text); ok {
+				text.WriteString(string(t))
+			}
+		}
+		onText(text.String())
+	}
+
+	if text.Len() == 0 {
+		return StorytellerResponse{}, fmt.Errorf("gemini returned an empty response")
+	}
+	return StorytellerResponse{Text: text.String(), Usage: usage}, nil
+}
+
+// Correct sends a JSON correction prompt to Gemini using the same system prompt.
+func (g *GeminiStoryteller) Correct(ctx context.Context, systemPrompt string, retryPrompt string) (StorytellerResponse, error) {
+	return g.generate(ctx, systemPrompt, retryPrompt)
+}
+
+func (g *GeminiStoryteller) generate(ctx context.Context, systemPrompt string, text string) (StorytellerResponse, error) {
+	model := g.model(systemPrompt, true)
+	resp, err := model.GenerateContent(ctx, genai.Text(text))
+	if err != nil {
+		return StorytellerResponse{}, err
+	}
+
+	out, err := geminiText(resp)
+	if err != nil {
+		return StorytellerResponse{}, err
+	}
+	return StorytellerResponse{Text: out, Usage: geminiUsage(resp)}, nil
+}
+
+// model configures a Gemini model for JSON output. Gemini emits schema properties in
+// alphabetical order, which puts new_game_state before story_update, and this genai
+// version cannot set an ordering. Streaming calls, which play every normal turn, therefore
+// leave the schema out and rely on the prompt and validateAIResponseSchema instead; see
+// the README.
+func (g *GeminiStoryteller) model(systemInstruction string, schema bool) *genai.GenerativeModel {
+	model := g.client.GenerativeModel(g.modelName)
+	temp := float32(0.9)
+	model.GenerationConfig = genai.GenerationConfig{
+		Temperature:      &temp,
+		ResponseMIMEType: "application/json",
+	}
+	if schema {
+		model.GenerationConfig.ResponseSchema = BuildAIResponseSchema()
+	}
+	if systemInstruction != "" {
+		model.SystemInstruction = &genai.Content{
+			Parts: []genai.Part{genai.Text(systemInstruction)},
+		}
+	}
+	return model
+}
+
+// geminiText extracts the text of the first candidate from a Gemini response.
+func geminiText(resp *genai.GenerateContentResponse) (string, error) {
+	if resp == nil || len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		return "", fmt.Errorf("gemini returned an empty response")
+	}
+	text, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
+	if !ok {
+		return "", fmt.Errorf("gemini returned a non-text response part")
+	}
+	return string(text), nil
+}
+
+// geminiUsage converts Gemini usage metadata into a TokenUsage.
+func geminiUsage(resp *genai.GenerateContentResponse) TokenUsage {
+	if resp == nil || resp.UsageMetadata == nil {
+		return TokenUsage{}
+	}
+	return TokenUsage{
+		PromptTokens:    int(resp.UsageMetadata.PromptTokenCount),
+		CandidateTokens: int(resp.UsageMetadata.CandidatesTokenCount),
+		TotalTokens:     int(resp.UsageMetadata.TotalTokenCount),
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"regexp"
 	"slices"
 	"story_ai/metrics"
+	"story_ai/middleware"
 	"story_ai/prompts"
 	"story_ai/session"
 	"story_ai/story"
@@ -22,7 +23,6 @@ import (
 	"unicode"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/google/generative-ai-go/genai"
 	"github.com/jung-kurt/gofpdf"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
@@ -42,8 +42,12 @@ type NarratorOption struct {
 }
 
 type Handler struct {
-	Client  *genai.Client
-	Manager *session.Manager
+	Storyteller Storyteller
+	Manager     *session.Manager
+	Budget      *TokenBudget    // Optional daily token limits; nil means unlimited
+	Breaker     *CircuitBreaker // Optional circuit breaker around model calls
+	CallTimeout time.Duration   // Deadline for each model call; zero means none
+	Recipes     *story.Cookbook // Optional crafting recipes by genre; nil leaves all crafting to the model
 }
 
 // AIResponse is the top-level structure for the AI's JSON response.
@@ -65,6 +69,8 @@ type StoryUpdate struct {
 type AIRequest struct {
 	GameState  *story.GameState `json:"game_state"`
 	UserAction string           `json:"user_action"`
+	SkillCheck *story.Check     `json:"skill_check,omitempty"`
+	Crafting   *story.Craft     `json:"crafting,omitempty"`
 }
 
 var (
@@ -123,7 +129,8 @@ func contains(slice []string, item string) bool {
 	return slices.Contains(slice, item)
 }
 
-// parseAIResponse unmarshals the JSON from the AI and cleans up the story text.
+// parseAIResponse unmarshals the JSON from the AI, checks it against the response
+// schema and cleans up the story text.
 func parseAIResponse(response string) (AIResponse, error) {
 	var aiResp AIResponse
 	cleanResponse := strings.TrimPrefix(response, "```json\n")
@@ -133,6 +140,9 @@ func parseAIResponse(response string) (AIResponse, error) {
 	if err != nil {
 		return aiResp, err
 	}
+	if violations := validateAIResponseSchema(aiResp); len(violations) > 0 {
+		return aiResp, &SchemaError{Violations: violations}
+	}
 
 	story := aiResp.StoryUpdate.Story
 	story = markdownBoldRegex.ReplaceAllString(story, "<strong>$1</strong>")
@@ -144,51 +154,57 @@ func parseAIResponse(response string) (AIResponse, error) {
 	return aiResp, nil
 }
 
-func (h *Handler) getModel(systemInstruction string) *genai.GenerativeModel {
-	model := h.Client.GenerativeModel("gemini-3.1-flash-lite-preview")
-	temp := float32(0.9)
-	model.GenerationConfig = genai.GenerationConfig{
-		Temperature:      &temp,
-		ResponseMIMEType: "application/json",
-	}
-	if systemInstruction != "" {
-		model.SystemInstruction = &genai.Content{
-			Parts: []genai.Part{genai.Text(systemInstruction)},
-		}
-	}
-	return model
-}
-
-func (h *Handler) parseAndRetryAIResponse(ctx context.Context, model *genai.GenerativeModel, originalResponse string) (AIResponse, error) {
+// parseAndRetryAIResponse parses a response, repairing it locally or asking the model to
+// correct it when needed. The returned usage covers only the correction calls.
+func (h *Handler) parseAndRetryAIResponse(ctx context.Context, systemPrompt string, originalResponse string) (AIResponse, TokenUsage, error) {
 	log.Printf("RAW AI RESPONSE: %s", originalResponse)
+	var retryUsage TokenUsage
 	aiResp, err := parseAIResponse(originalResponse)
 	if err == nil {
-		return aiResp, nil
+		return aiResp, retryUsage, nil
+	}
+
+	// Try cheap, local fixes before spending a model call.
+	if repaired, strategies := repairJSON(originalResponse); len(strategies) > 0 {
+		repairedResp, repairErr := parseAIResponse(repaired)
+		for _, strategy := range strategies {
+			metrics.RecordJSONRepair(strategy, repairErr == nil)
+		}
+		if repairErr == nil {
+			log.Printf("Repaired AI JSON locally using %s.", strings.Join(strategies, ", "))
+			return repairedResp, retryUsage, nil
+		}
+		if _, isSchemaErr := repairErr.(*SchemaError); isSchemaErr {
+			// The repair produced valid JSON; ask the model to fix only the schema problems.
+			originalResponse = repaired
+		}
+		err = repairErr
 	}
 
 	log.Printf("Initial JSON parsing failed: %v. Retrying with the AI.", err)
 
 	for i := range 3 { // Retry up to 3 times
-		retryPrompt := fmt.Sprintf(prompts.JsonRetryPrompt, originalResponse)
-		resp, retryErr := model.GenerateContent(ctx, genai.Text(retryPrompt))
+		retryPrompt := fmt.Sprintf(prompts.JsonRetryPrompt, describeResponseProblems(err), originalResponse)
+		resp, retryErr := h.guardedCall(ctx, func(ctx context.Context) (StorytellerResponse, error) {
+			return h.Storyteller.Correct(ctx, systemPrompt, retryPrompt)
+		})
+		retryUsage.Add(resp.Usage)
 		if retryErr != nil {
 			log.Printf("AI retry attempt %d failed: %v", i+1, retryErr)
 			continue
 		}
 
-		if len(resp.Candidates) > 0 && len(resp.Candidates[0].Content.Parts) > 0 {
-			correctedResponse := string(resp.Candidates[0].Content.Parts[0].(genai.Text))
-			aiResp, err = parseAIResponse(correctedResponse)
-			if err == nil {
-				log.Printf("AI successfully corrected the JSON on attempt %d.", i+1)
-				return aiResp, nil
-			}
-			log.Printf("AI retry attempt %d still resulted in invalid JSON: %v", i+1, err)
-			originalResponse = correctedResponse // Use the corrected (but still invalid) response for the next retry
+		correctedResponse := resp.Text
+		aiResp, err = parseAIResponse(correctedResponse)
+		if err == nil {
+			log.Printf("AI successfully corrected the JSON on attempt %d.", i+1)
+			return aiResp, retryUsage, nil
 		}
+		log.Printf("AI retry attempt %d still resulted in invalid JSON: %v", i+1, err)
+		originalResponse = correctedResponse // Use the corrected (but still invalid) response for the next retry
 	}
 
-	return AIResponse{}, fmt.Errorf("failed to parse AI response after multiple retries")
+	return AIResponse{}, retryUsage, fmt.Errorf("failed to parse AI response after multiple retries")
 }
 
 func prettyPrint(v any) string {
@@ -270,7 +286,6 @@ func (h *Handler) StartStory(w http.ResponseWriter, r *http.Request) {
 	consequenceModel := r.URL.Query().Get("consequence_model")
 
 	// Validate genre parameter
-	validGenres := []string{"fantasy", "sci-fi", "historical-fiction"}
 	if genre != "" && !contains(validGenres, genre) {
 		metrics.RecordStoryGeneration(time.Since(startTime), genre, consequenceModel, false)
 		err := fmt.Errorf("invalid genre parameter: %s", genre)
@@ -279,7 +294,6 @@ func (h *Handler) StartStory(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate consequence model parameter
-	validModels := []string{"exploratory", "challenging", "punishing"}
 	if consequenceModel != "" && !contains(validModels, consequenceModel) {
 		metrics.RecordStoryGeneration(time.Since(startTime), genre, consequenceModel, false)
 		err := fmt.Errorf("invalid consequence_model parameter: %s", consequenceModel)
@@ -287,17 +301,37 @@ func (h *Handler) StartStory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	character, err := characterFromQuery(r.URL.Query(), genre, sess.GameState.Character)
+	if err != nil {
+		metrics.RecordStoryGeneration(time.Since(startTime), genre, consequenceModel, false)
+		handleStartStoryError(w, r, err, ErrorTypeValidation)
+		return
+	}
+
+	if err := h.checkBudget(r, sess); err != nil {
+		metrics.RecordStoryGeneration(time.Since(startTime), genre, consequenceModel, false)
+		handleStartStoryError(w, r, err, ErrorTypeBudget)
+		return
+	}
+
 	sess.GameState.Rules.ConsequenceModel = consequenceModel
 	sess.CurrentGenre = genre
 
 	// Reset story history for a new game
 	sess.StoryHistory = []story.StoryPage{}
+	sess.KnownRooms = nil
+	sess.WorldMap = nil
+	sess.Journal = nil
+	sess.ShowObjectives = false
+	sess.Rewinds = 0
+	sess.ParentID, sess.ForkTurn = "", 0
+	sess.DiceSeed, sess.TurnCheck, sess.TurnCraft = h.newDiceSeed(), nil, nil
 	sess.NarratorPersona = ""
 
 	author := h.pickNarrator(sess, genre)
 
 	sess.CurrentAuthor = author
-	log.Printf("--- NEW STORY --- Author: %s, Genre: %s, Difficulty: %s", author, genre, consequenceModel)
+	log.Printf("--- NEW STORY --- Author: %s, Genre: %s, Difficulty: %s, Dice seed: %d", author, genre, consequenceModel, sess.DiceSeed)
 	go pingStatsService("start", nil)
 
 	var prompt string
@@ -342,15 +376,19 @@ func (h *Handler) StartStory(w http.ResponseWriter, r *http.Request) {
 		prompt = h.buildSystemPrompt(sess)
 	}
 
+	if character != nil {
+		log.Printf("--- CHARACTER --- %s, %s (%s)", character.Name, character.Role, strings.Join(character.Traits, ", "))
+	}
 	initialRequest := AIRequest{
 		GameState: &story.GameState{
-			PlayerStatus:      story.PlayerStatus{Health: 100, Stamina: 100, Conditions: make([]string, 0)},
+			Character:         character,
+			PlayerStatus:      story.PlayerStatus{Health: 100, Stamina: 100, Conditions: make([]story.Condition, 0)},
 			Inventory:         make([]story.Item, 0),
 			Environment:       story.Environment{Exits: make(map[string]string), WorldObjects: make([]story.WorldObject, 0)},
 			NPCs:              make([]story.NPC, 0),
 			Puzzles:           make([]story.Puzzle, 0),
 			ProperNouns:       make([]story.ProperNoun, 0),
-			Rules:             story.Rules{ConsequenceModel: consequenceModel},
+			Rules:             story.Rules{ConsequenceModel: consequenceModel, CarryLimit: story.CarryLimit(consequenceModel)},
 			World:             story.World{WorldTension: 0},
 			Climax:            false,
 			WinConditions:     make([]string, 0),
@@ -359,27 +397,31 @@ func (h *Handler) StartStory(w http.ResponseWriter, r *http.Request) {
 		},
 		UserAction: "Start the game.",
 	}
-	reqBytes, err := json.Marshal(initialRequest)
-	if err != nil {
-		http.Error(w, "Failed to create initial AI request.", http.StatusInternalServerError)
-		return
-	}
-
-	model := h.getModel(prompt)
 
-	resp, err := model.GenerateContent(context.Background(), genai.Text(string(reqBytes)))
-	if err != nil || len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+	resp, err := h.callModel(r, sess, func(ctx context.Context) (StorytellerResponse, error) {
+		return h.Storyteller.Tell(ctx, prompt, initialRequest)
+	})
+	if err != nil {
 		log.Printf("AI ERROR (StartStory): %v", err)
-		http.Error(w, "The AI failed to start the story. Please try again.", http.StatusInternalServerError)
+		metrics.RecordStoryGeneration(time.Since(startTime), genre, consequenceModel, false)
+		handleStartStoryError(w, r, err, classifyAIError(err).Type)
 		return
 	}
 
-	aiResp, err := h.parseAndRetryAIResponse(context.Background(), model, string(resp.Candidates[0].Content.Parts[0].(genai.Text)))
+	// A new story starts a new token tally.
+	sess.PromptTokens, sess.CandidateTokens, sess.TotalTokens = 0, 0, 0
+
+	aiResp, retryUsage, err := h.parseAndRetryAIResponse(r.Context(), prompt, resp.Text)
+	h.recordUsage(r, sess, resp.Usage, retryUsage)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to parse AI's initial response: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	// The opening turn is repaired but never re-asked; it must keep the chosen difficulty.
+	sess.GameState = initialRequest.GameState
+	aiResp, _ = h.enforceInvariants(r, sess, initialRequest.UserAction, prompt, aiResp, false)
+
 	// log.Printf("--- NEW GAME STATE (START) --- %s", prettyPrint(aiResp.NewGameState))
 
 	if aiResp.StoryUpdate.BackgroundColor == "" {
@@ -388,27 +430,15 @@ func (h *Handler) StartStory(w http.ResponseWriter, r *http.Request) {
 
 	sess.GameState = aiResp.NewGameState
 	// The FoundItems list will be empty on start, so no need to update it yet.
-	storyText := aiResp.StoryUpdate.Story
+	storyText := sanitizeStoryText(aiResp.StoryUpdate.Story)
 	if sess.NarratorPersona == "stanley" && !strings.HasPrefix(storyText, "This is the story of a man named Stanley.") {
 		storyText = "This is the story of a man named Stanley.<br><br>" + storyText
 	}
-	sess.StoryHistory = []story.StoryPage{{Prompt: "Start", Response: storyText}}
-
-	placeholder := "What do you do?"
-	switch sess.NarratorPersona {
-	case "stanley":
-		placeholder = "What does Stanley do?"
-	case "dr_seuss":
-		placeholder = "Now what will you do?"
-	case "tolstoy_camus":
-		placeholder = "What is the logical choice?"
-	case "bastion":
-		placeholder = "What does the Kid do?"
-	case "thompson":
-		placeholder = "What do I do?"
-	}
+	sess.StoryHistory = []story.StoryPage{{Prompt: "Start", Response: storyText, State: sess.GameState.Clone()}}
+	rememberRoom(sess)
+	recordJournal(sess, nil, story.StateDiff{}, storyText)
 
-	templates.StoryView(storyText, aiResp.NewGameState.PlayerStatus, aiResp.NewGameState.Inventory, aiResp.StoryUpdate.BackgroundColor, genre, aiResp.NewGameState.World.WorldTension, consequenceModel, placeholder).Render(context.Background(), w)
+	templates.StoryView(sess.StoryHistory, aiResp.NewGameState.PlayerStatus, aiResp.NewGameState.Inventory, aiResp.StoryUpdate.BackgroundColor, genre, aiResp.NewGameState.World.WorldTension, consequenceModel, placeholderFor(sess.NarratorPersona), sess.WorldMap, journalView(sess), canRewind(sess), aiResp.StoryUpdate.GameOver, sess.CurrentAuthor, sess.TotalTokens).Render(context.Background(), w)
 
 	// Record successful story generation metrics
 	metrics.RecordStoryGeneration(time.Since(startTime), genre, consequenceModel, true)
@@ -602,32 +632,90 @@ func (h *Handler) Generate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Out of budget: tell the player in the story instead of calling the model.
+	if err := h.checkBudget(r, sess); err != nil {
+		handleSystemError(w, r, sess, userAction, err, ErrorTypeBudget)
+		return
+	}
+
+	// Streaming backends deliver the turn over /stream; render the placeholder page that connects to it.
+	if _, ok := h.Storyteller.(StreamingStoryteller); ok {
+		sess.PendingAction = userAction
+		templates.StreamingTurn(userAction).Render(r.Context(), w)
+		return
+	}
+
 	systemPrompt := h.buildSystemPrompt(sess)
 
 	aiRequest := AIRequest{
 		GameState:  sess.GameState,
-		UserAction: userAction,
+		UserAction: modelAction(sess.ID, userAction),
+		SkillCheck: rollCheck(sess, userAction),
+		Crafting:   h.planCraft(sess, userAction),
 	}
-	reqBytes, err := json.Marshal(aiRequest)
+
+	resp, err := h.callModel(r, sess, func(ctx context.Context) (StorytellerResponse, error) {
+		return h.Storyteller.Tell(ctx, systemPrompt, aiRequest)
+	})
 	if err != nil {
-		http.Error(w, "Failed to create AI request.", http.StatusInternalServerError)
+		h.handleAIError(w, r, sess, userAction, err, startTime)
 		return
 	}
 
-	model := h.getModel(systemPrompt)
+	h.finishTurn(w, r, sess, userAction, systemPrompt, resp, startTime)
+}
 
-	resp, err := model.GenerateContent(r.Context(), genai.Text(string(reqBytes)))
-	if err != nil || len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		handleAIError(w, r, sess, userAction, err, startTime)
-		return
+// placeholderFor returns the prompt box placeholder for a narrator persona.
+func placeholderFor(persona string) string {
+	switch persona {
+	case "stanley":
+		return "What does Stanley do?"
+	case "dr_seuss":
+		return "Now what will you do?"
+	case "tolstoy_camus":
+		return "What is the logical choice?"
+	case "bastion":
+		return "What does the Kid do?"
+	case "thompson":
+		return "What do I do?"
 	}
+	return "What do you do?"
+}
 
-	aiResp, err := h.parseAndRetryAIResponse(r.Context(), model, string(resp.Candidates[0].Content.Parts[0].(genai.Text)))
+// finishTurn parses the model's response for a turn, commits the new state to the
+// session and renders the update. Nothing is committed if the response cannot be parsed.
+func (h *Handler) finishTurn(w http.ResponseWriter, r *http.Request, sess *session.Session, userAction string, systemPrompt string, resp StorytellerResponse, startTime time.Time) {
+	aiResp, retryUsage, err := h.parseAndRetryAIResponse(r.Context(), systemPrompt, resp.Text)
+	h.recordUsage(r, sess, resp.Usage, retryUsage)
+	turnUsage := resp.Usage
+	turnUsage.Add(retryUsage)
 	if err != nil {
 		handleSystemError(w, r, sess, userAction, err, ErrorTypeAI)
 		return
 	}
 
+	aiResp, reviewUsage, ok := h.reviewTurnState(r, sess, userAction, systemPrompt, aiResp)
+	h.recordUsage(r, sess, reviewUsage)
+	turnUsage.Add(reviewUsage)
+	if !ok {
+		sess.StoryHistory = append(sess.StoryHistory, createErrorPage(userAction, quarantinedTurnError))
+		templates.Update(sess.StoryHistory, sess.GameState.PlayerStatus, sess.GameState.Inventory, "#1e1e1e", false, false, sess.CurrentGenre, sess.GameState.Rules.ConsequenceModel, sess.GameState.World.WorldTension, sess.CurrentAuthor, sess.TotalTokens, sess.WorldMap, journalView(sess), canRewind(sess)).Render(r.Context(), w)
+		return
+	}
+
+	aiResp, reaskUsage := h.enforceInvariants(r, sess, userAction, systemPrompt, aiResp, true)
+	h.recordUsage(r, sess, reaskUsage)
+	turnUsage.Add(reaskUsage)
+
+	// The turn's skill check and craft were settled before the model was asked and stay on
+	// the session, so every re-ask sends the same ones. The server's own changes from them
+	// and from the item and status rules are added to the model's report, so the change
+	// log neither flags them as mismatches nor drops them.
+	applyCraft(sess, &aiResp)
+	items := story.SettleItems(sess.GameState, aiResp.NewGameState, userAction, sess.TurnCheck)
+	tick := story.Tick(sess.GameState, aiResp.NewGameState, userAction, sess.TurnCheck)
+	aiResp = settleTurn(sess, aiResp, tick, items)
+
 	// log.Printf("--- NEW GAME STATE (GENERATE) --- %s", prettyPrint(aiResp.NewGameState))
 
 	if aiResp.StoryUpdate.BackgroundColor == "" {
@@ -650,19 +738,59 @@ func (h *Handler) Generate(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	changes := story.Diff(sess.GameState, aiResp.NewGameState)
+	mismatches := changes.Mismatches(aiResp.StoryUpdate.ItemsAdded, aiResp.StoryUpdate.ItemsRemoved)
+	for _, mismatch := range mismatches {
+		log.Printf("Inventory mismatch in session %s: %s", sess.ID, mismatch)
+		metrics.RecordInventoryMismatch(h.Storyteller.Name())
+	}
+
 	// Update the rest of the game state, but preserve our master noun list.
+	before := sess.GameState
 	updatedNouns := sess.GameState.ProperNouns
 	sess.GameState = aiResp.NewGameState
 	sess.GameState.ProperNouns = updatedNouns
 
-	storyText := aiResp.StoryUpdate.Story // Use nouns from this turn for tooltips
-	sess.StoryHistory = append(sess.StoryHistory, story.StoryPage{Prompt: userAction, Response: storyText})
+	storyText := sanitizeStoryText(aiResp.StoryUpdate.Story) // Use nouns from this turn for tooltips
+	sess.StoryHistory = append(sess.StoryHistory, story.StoryPage{Prompt: userAction, Response: storyText, Changes: changes, Mismatches: mismatches, Check: sess.TurnCheck, State: sess.GameState.Clone()})
+	rememberRoom(sess)
+	recordJournal(sess, before, changes, storyText)
+	recordCheck(sess)
 
 	// Record successful AI API usage and user activity metrics
-	metrics.RecordAPIUsage("gemini", 0, time.Since(startTime), true) // Token count would need to be extracted from AI response
+	metrics.RecordAPIUsage(h.Storyteller.Name(), turnUsage.TotalTokens, time.Since(startTime), true)
 	metrics.RecordUserActivity("generate_response", sess.CurrentGenre, time.Since(startTime))
 
-	templates.Update(sess.StoryHistory, sess.GameState.PlayerStatus, sess.GameState.Inventory, aiResp.StoryUpdate.BackgroundColor, aiResp.StoryUpdate.GameOver, sess.GameState.GameWon, sess.CurrentGenre, sess.GameState.Rules.ConsequenceModel, sess.GameState.World.WorldTension, sess.CurrentAuthor).Render(context.Background(), w)
+	templates.Update(sess.StoryHistory, sess.GameState.PlayerStatus, sess.GameState.Inventory, aiResp.StoryUpdate.BackgroundColor, aiResp.StoryUpdate.GameOver, sess.GameState.GameWon, sess.CurrentGenre, sess.GameState.Rules.ConsequenceModel, sess.GameState.World.WorldTension, sess.CurrentAuthor, sess.TotalTokens, sess.WorldMap, journalView(sess), canRewind(sess)).Render(context.Background(), w)
+}
+
+// recordUsage adds the tokens spent on a model call and its corrections to the
+// session's running total, the daily budgets and the per-genre/persona/difficulty metrics.
+func (h *Handler) recordUsage(r *http.Request, sess *session.Session, usages ...TokenUsage) {
+	var total TokenUsage
+	for _, u := range usages {
+		total.Add(u)
+	}
+	sess.PromptTokens += total.PromptTokens
+	sess.CandidateTokens += total.CandidateTokens
+	sess.TotalTokens += total.TotalTokens
+	metrics.RecordTokenUsage(h.Storyteller.Name(), sess.CurrentGenre, sess.NarratorPersona, sess.GameState.Rules.ConsequenceModel, total.PromptTokens, total.CandidateTokens, total.TotalTokens)
+	if h.Budget != nil {
+		h.Budget.Spend(sess.BudgetID(), middleware.ClientIP(r), total.TotalTokens)
+	}
+}
+
+// checkBudget returns a *BudgetExceededError if the session, its client IP or the server
+// has used up its daily token budget.
+func (h *Handler) checkBudget(r *http.Request, sess *session.Session) error {
+	if h.Budget == nil {
+		return nil
+	}
+	err := h.Budget.Check(sess.BudgetID(), middleware.ClientIP(r))
+	if budgetErr, ok := err.(*BudgetExceededError); ok {
+		metrics.RecordBudgetExhausted(budgetErr.Scope)
+	}
+	return err
 }
 
 // writeHtmlToPdf parses a simple HTML string and writes it to the PDF, handling nested styles.
@@ -806,9 +934,25 @@ func (h *Handler) DownloadStory(w http.ResponseWriter, r *http.Request) {
 	pdf.CellFormat(0, 10, subtitle, "", 1, "C", false, 0, "")
 	pdf.Ln(5)
 
+	if c := sess.GameState.Character; c != nil {
+		pdf.SetFont("Times", "B", 18)
+		pdf.CellFormat(0, 10, c.Name, "", 1, "C", false, 0, "")
+		pdf.SetFont("Times", "I", 14)
+		pdf.CellFormat(0, 8, characterLine(c), "", 1, "C", false, 0, "")
+		pdf.Ln(5)
+	}
+
 	pdf.SetFont("Times", "", 12)
 	difficulty := fmt.Sprintf("Difficulty: %s", cases.Title(language.English).String(sess.GameState.Rules.ConsequenceModel))
 	pdf.CellFormat(0, 10, difficulty, "", 1, "C", false, 0, "")
+	if sess.Rewinds > 0 {
+		rewound := "Rewound once"
+		if sess.Rewinds > 1 {
+			rewound = fmt.Sprintf("Rewound %d times", sess.Rewinds)
+		}
+		pdf.SetFont("Times", "I", 12)
+		pdf.CellFormat(0, 8, rewound, "", 1, "C", false, 0, "")
+	}
 
 	if sess.CurrentGenre == "historical-fiction" {
 		pdf.Ln(20)
@@ -834,6 +978,11 @@ func (h *Handler) DownloadStory(w http.ResponseWriter, r *http.Request) {
 		pdf.SetFont("Times", "I", 12)
 		pdf.SetTextColor(64, 64, 64)
 		pdf.MultiCell(0, 6, "> "+page.Prompt, "", "", false)
+		if page.Check != nil {
+			pdf.SetFont("Times", "I", 9)
+			pdf.SetTextColor(128, 128, 128)
+			pdf.MultiCell(0, 5, "[Roll: "+page.Check.String()+"]", "", "", false)
+		}
 		pdf.Ln(6)
 
 		pdf.SetFont("Times", "", 12)
@@ -842,6 +991,15 @@ func (h *Handler) DownloadStory(w http.ResponseWriter, r *http.Request) {
 		pdf.Ln(12)
 	}
 
+	// World Map Page
+	if sess.WorldMap != nil && len(sess.WorldMap.Nodes) > 1 {
+		pdf.AddPage()
+		pdf.SetFont("Times", "B", 24)
+		pdf.CellFormat(0, 10, "Map of the World", "", 1, "C", false, 0, "")
+		pdf.Ln(10)
+		writeWorldMapToPdf(pdf, sess.WorldMap)
+	}
+
 	// Glossary Page
 	if len(sess.GameState.ProperNouns) > 0 {
 		pdf.AddPage()
@@ -873,6 +1031,64 @@ func (h *Handler) DownloadStory(w http.ResponseWriter, r *http.Request) {
 	w.Write(pdfBuffer.Bytes())
 }
 
+// writeWorldMapToPdf draws the world map below the current position, scaled to fit the page.
+func writeWorldMapToPdf(pdf *gofpdf.Fpdf, worldMap *story.WorldMap) {
+	points := worldMap.Layout()
+	cols, rows := 0, 0
+	for _, p := range points {
+		cols, rows = max(cols, p.X+1), max(rows, p.Y+1)
+	}
+
+	left, top, right, _ := pdf.GetMargins()
+	pageWidth, pageHeight := pdf.GetPageSize()
+	originY := pdf.GetY()
+	cellWidth := min(45, (pageWidth-left-right)/float64(cols))
+	cellHeight := min(25, (pageHeight-originY-top-10)/float64(rows))
+	originX := left + (pageWidth-left-right-cellWidth*float64(cols))/2
+	nodeWidth, nodeHeight := cellWidth*0.85, min(10, cellHeight*0.5)
+	center := func(name string) (float64, float64) {
+		p := points[name]
+		return originX + (float64(p.X)+0.5)*cellWidth, originY + (float64(p.Y)+0.5)*cellHeight
+	}
+
+	pdf.SetLineWidth(0.4)
+	pdf.SetDrawColor(150, 150, 150)
+	for _, e := range worldMap.Connections() {
+		x1, y1 := center(e.From)
+		x2, y2 := center(e.To)
+		pdf.Line(x1, y1, x2, y2)
+	}
+
+	pdf.SetFont("Times", "", min(10, nodeHeight*2))
+	for _, n := range worldMap.Nodes {
+		x, y := center(n.Name)
+		pdf.SetFillColor(255, 255, 255)
+		pdf.SetDrawColor(64, 64, 64)
+		pdf.SetTextColor(0, 0, 0)
+		switch {
+		case n.Name == worldMap.Current:
+			pdf.SetFillColor(220, 235, 190)
+			pdf.SetLineWidth(0.8)
+		case !n.Visited:
+			pdf.SetDashPattern([]float64{1.5, 1}, 0)
+			pdf.SetDrawColor(150, 150, 150)
+			pdf.SetTextColor(120, 120, 120)
+		}
+		pdf.RoundedRect(x-nodeWidth/2, y-nodeHeight/2, nodeWidth, nodeHeight, 1.5, "1234", "FD")
+		pdf.SetDashPattern(nil, 0)
+		pdf.SetLineWidth(0.4)
+
+		label := n.Name
+		for len(label) > 1 && pdf.GetStringWidth(label) > nodeWidth-2 {
+			label = strings.TrimSpace(label[:len(label)-2]) + "."
+		}
+		pdf.SetXY(x-nodeWidth/2, y-nodeHeight/2)
+		pdf.CellFormat(nodeWidth, nodeHeight, label, "", 0, "C", false, 0, "")
+	}
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetY(originY + cellHeight*float64(rows) + 5)
+}
+
 // pingStatsService sends a POST request to the stats service.
 // For sending PDFs, the pdfData should contain the raw PDF bytes.
 func pingStatsService(endpoint string, pdfData []byte) {
@@ -78,15 +78,32 @@ func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 
 // ReadinessHandler provides a readiness check endpoint
 func ReadinessHandler(w http.ResponseWriter, r *http.Request) {
-	// Add more comprehensive checks here in the future
-	// For now, just check if the service has been running for at least 5 seconds
-	if time.Since(startTime) < 5*time.Second {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		w.Write([]byte(`{"status":"not ready"}`))
-		return
-	}
+	NewReadinessHandler(nil)(w, r)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status":"ready"}`))
+// NewReadinessHandler returns a readiness endpoint that also reports the state of the
+// AI circuit breaker. An open breaker does not make the service unready: stories are
+// still served from the fallback path while it is open.
+func NewReadinessHandler(breaker *CircuitBreaker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Add more comprehensive checks here in the future
+		// For now, just check if the service has been running for at least 5 seconds
+		if time.Since(startTime) < 5*time.Second {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status":"not ready"}`))
+			return
+		}
+
+		response := map[string]string{"status": "ready"}
+		if breaker != nil {
+			response["circuit_breaker"] = breaker.State()
+			if response["circuit_breaker"] != BreakerClosed {
+				response["status"] = "degraded"
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	}
 }
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"story_ai/metrics"
+	"story_ai/prompts"
+	"story_ai/session"
+	"story_ai/story"
+	"strings"
+)
+
+// injectionPattern is a phrase that suggests the player is instructing the model
+// instead of playing. Weight 2 patterns are suspicious on their own.
+type injectionPattern struct {
+	name   string
+	regex  *regexp.Regexp
+	weight int
+}
+
+var injectionPatterns = []injectionPattern{
+	{"ignore_instructions", regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override)\b.{0,30}\b(rules?|instructions?|prompts?|guidelines|system)\b`), 2},
+	{"role_change", regexp.MustCompile(`(?i)\b(you are now|you're now|from now on you|act as|pretend (to be|you are)|new role)\b`), 2},
+	{"prompt_reference", regexp.MustCompile(`(?i)\b(system prompt|developer mode|jailbreak|game ?master ai|gmai|as an ai)\b`), 2},
+	{"state_field", regexp.MustCompile(`(?i)\b(new_game_state|game_state|story_update|json|hp|sp|won|lost|tension|consequence_?model)\b\s*[:=]`), 2},
+	{"set_stat", regexp.MustCompile(`(?i)\b(set|make|change|increase|restore)\b.{0,20}\b(hp|health|stamina|sp|tension|difficulty)\b.{0,10}\b(to|=)\s*\d+`), 2},
+	{"grant_item", regexp.MustCompile(`(?i)\b(give me|add|spawn|put)\b.{0,30}\b(to|in|into) my inventory\b`), 1},
+	{"declare_win", regexp.MustCompile(`(?i)\b(i win|make me win|i have won|set won|end the game (as|with) (a )?win)\b`), 2},
+}
+
+// injectionThreshold is the score at which an action is treated as suspicious.
+const injectionThreshold = 2
+
+// InjectionSignal is the result of checking a player action for prompt injection.
+type InjectionSignal struct {
+	Score   int
+	Matches []string
+}
+
+// Suspicious reports whether the action should be neutralised before it reaches the model.
+func (s InjectionSignal) Suspicious() bool {
+	return s.Score >= injectionThreshold
+}
+
+// detectInjection scores a player action against the injection patterns.
+func detectInjection(action string) InjectionSignal {
+	var signal InjectionSignal
+	for _, p := range injectionPatterns {
+		if p.regex.MatchString(action) {
+			signal.Score += p.weight
+			signal.Matches = append(signal.Matches, p.name)
+		}
+	}
+	return signal
+}
+
+// neutraliseAction wraps a suspicious action so the model treats it as in-world speech.
+func neutraliseAction(action string) string {
+	return fmt.Sprintf(prompts.NeutralisedActionPrompt, strings.ReplaceAll(action, `"`, `'`))
+}
+
+// Limits used by checkStatePlausibility.
+const (
+	maxPlausibleHealthGain  = 30
+	maxPlausibleStaminaGain = 50
+	maxPlausibleNewItems    = 3
+)
+
+// checkStatePlausibility compares the state before and after a turn and lists changes
+// the story is unlikely to have earned: large stat jumps, items that appear without
+// being announced or a changed difficulty. A win is only suspect alongside one of those
+// or after a suspicious action; a missing game_over is left to enforceInvariants.
+func checkStatePlausibility(before, after *story.GameState, update StoryUpdate, suspicious bool) []string {
+	var problems []string
+	if before == nil || after == nil {
+		return problems
+	}
+
+	if gain := after.PlayerStatus.Health - before.PlayerStatus.Health; gain > maxPlausibleHealthGain {
+		problems = append(problems, fmt.Sprintf("hp rose by %d in one turn", gain))
+	}
+	if gain := after.PlayerStatus.Stamina - before.PlayerStatus.Stamina; gain > maxPlausibleStaminaGain {
+		problems = append(problems, fmt.Sprintf("sp rose by %d in one turn", gain))
+	}
+
+	had := make(map[string]bool)
+	for _, item := range before.Inventory {
+		had[strings.ToLower(item.Name)] = true
+	}
+	announced := make(map[string]bool)
+	for _, name := range update.ItemsAdded {
+		announced[strings.ToLower(name)] = true
+	}
+	newItems := 0
+	for _, item := range after.Inventory {
+		name := strings.ToLower(item.Name)
+		if had[name] {
+			continue
+		}
+		newItems++
+		if !announced[name] {
+			problems = append(problems, fmt.Sprintf("%q appeared in the inventory without being added", item.Name))
+		}
+	}
+	if newItems > maxPlausibleNewItems {
+		problems = append(problems, fmt.Sprintf("%d items were gained in one turn", newItems))
+	}
+
+	if before.Rules.ConsequenceModel != "" && after.Rules.ConsequenceModel != before.Rules.ConsequenceModel {
+		problems = append(problems, fmt.Sprintf("difficulty changed from %s to %s", before.Rules.ConsequenceModel, after.Rules.ConsequenceModel))
+	}
+	if after.GameWon && !before.GameWon && (len(problems) > 0 || suspicious) {
+		problems = append(problems, "the game was won")
+	}
+	return problems
+}
+
+// Outcomes of an injection check, as logged and counted in metrics.
+const (
+	injectionNeutralised = "neutralised"
+	injectionRerun       = "rerun"
+	injectionQuarantined = "quarantined"
+	injectionImplausible = "implausible_state"
+)
+
+// injectionCase is one suspicious turn, logged as a single JSON line for review.
+type injectionCase struct {
+	SessionID string   `json:"session_id"`
+	Action    string   `json:"action"`
+	Score     int      `json:"score"`
+	Matches   []string `json:"matches,omitempty"`
+	Problems  []string `json:"problems,omitempty"`
+	Outcome   string   `json:"outcome"`
+}
+
+// logInjectionCase records a suspicious turn in the server log and metrics.
+func logInjectionCase(c injectionCase) {
+	metrics.RecordPromptInjection(c.Outcome)
+	line, err := json.Marshal(c)
+	if err != nil {
+		log.Printf("PROMPT INJECTION %s: failed to encode case: %v", c.Outcome, err)
+		return
+	}
+	log.Printf("PROMPT INJECTION %s", line)
+}
+
+// modelAction returns the action to send to the model, neutralising it (and logging the
+// case) when it looks like an attempt to instruct the model.
+func modelAction(sessionID, action string) string {
+	signal := detectInjection(action)
+	if !signal.Suspicious() {
+		return action
+	}
+	logInjectionCase(injectionCase{SessionID: sessionID, Action: action, Score: signal.Score, Matches: signal.Matches, Outcome: injectionNeutralised})
+	return neutraliseAction(action)
+}
+
+// reviewTurnState checks a parsed turn for implausible state changes. Changes following a
+// suspicious action are re-run once with the action neutralised; if the re-run is still
+// implausible the turn is quarantined and ok is false. Other implausible turns are only logged.
+func (h *Handler) reviewTurnState(r *http.Request, sess *session.Session, userAction string, systemPrompt string, aiResp AIResponse) (AIResponse, TokenUsage, bool) {
+	var usage TokenUsage
+	signal := detectInjection(userAction)
+	problems := checkStatePlausibility(sess.GameState, aiResp.NewGameState, aiResp.StoryUpdate, signal.Suspicious())
+	if len(problems) == 0 {
+		return aiResp, usage, true
+	}
+
+	c := injectionCase{SessionID: sess.ID, Action: userAction, Score: signal.Score, Matches: signal.Matches, Problems: problems}
+	if !signal.Suspicious() {
+		c.Outcome = injectionImplausible
+		logInjectionCase(c)
+		return aiResp, usage, true
+	}
+
+	c.Outcome = injectionRerun
+	logInjectionCase(c)
+
+	aiRequest := AIRequest{
+		GameState:  sess.GameState,
+		UserAction: neutraliseAction(userAction) + fmt.Sprintf(prompts.ImplausibleStateRetryPrompt, "- "+strings.Join(problems, "\n- ")),
+		SkillCheck: sess.TurnCheck,
+		Crafting:   sess.TurnCraft,
+	}
+	resp, err := h.callModel(r, sess, func(ctx context.Context) (StorytellerResponse, error) {
+		return h.Storyteller.Tell(ctx, systemPrompt, aiRequest)
+	})
+	usage.Add(resp.Usage)
+	if err == nil {
+		var retryUsage TokenUsage
+		var rerun AIResponse
+		rerun, retryUsage, err = h.parseAndRetryAIResponse(r.Context(), systemPrompt, resp.Text)
+		usage.Add(retryUsage)
+		if err == nil {
+			// The re-run was asked with the action neutralised, so it is judged on its own changes.
+			c.Problems = checkStatePlausibility(sess.GameState, rerun.NewGameState, rerun.StoryUpdate, false)
+			if len(c.Problems) == 0 {
+				return rerun, usage, true
+			}
+		}
+	}
+
+	c.Outcome = injectionQuarantined
+	if err != nil {
+		c.Problems = append(c.Problems, "re-run failed: "+err.Error())
+	}
+	logInjectionCase(c)
+	return aiResp, usage, false
+}
+
+// quarantinedTurnError is shown when a turn is discarded by reviewTurnState.
+var quarantinedTurnError = UserFriendlyError{
+	Type:       ErrorTypeValidation,
+	Message:    "The story refuses to bend that way, and the world stays as it was.",
+	Suggestion: "Describe what your character does or says, rather than what the story should do.",
+	CanRetry:   true,
+}
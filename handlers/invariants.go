@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"story_ai/metrics"
+	"story_ai/prompts"
+	"story_ai/session"
+	"story_ai/story"
+	"strings"
+)
+
+// How a broken invariant was handled, as counted in metrics.
+const (
+	correctionRepaired = "repaired"
+	correctionReasked  = "reasked"
+)
+
+// enforceInvariants holds a turn to the game-state invariants in the story package.
+// Breaks that change the outcome of the turn (a game both won and lost, half the
+// inventory silently gone) are sent back to the model once when reask is set, since the
+// story text likely describes them; everything else, and anything the re-ask does not
+// fix, is repaired in place.
+func (h *Handler) enforceInvariants(r *http.Request, sess *session.Session, userAction string, systemPrompt string, aiResp AIResponse, reask bool) (AIResponse, TokenUsage) {
+	var usage TokenUsage
+	result := story.Enforce(sess.GameState, aiResp.NewGameState, aiResp.StoryUpdate.GameOver, aiResp.StoryUpdate.ItemsRemoved)
+
+	if severe := result.Severe(); reask && len(severe) > 0 {
+		details := make([]string, len(severe))
+		for i, c := range severe {
+			details[i] = c.Detail
+			metrics.RecordStateCorrection(c.Invariant, correctionReasked)
+		}
+		log.Printf("Game state invariants broken in session %s, asking again: %s", sess.ID, strings.Join(details, "; "))
+
+		action := userAction
+		if detectInjection(userAction).Suspicious() {
+			action = neutraliseAction(userAction)
+		}
+		aiRequest := AIRequest{
+			GameState:  sess.GameState,
+			UserAction: action + fmt.Sprintf(prompts.InvariantRetryPrompt, "- "+strings.Join(details, "\n- ")),
+			SkillCheck: sess.TurnCheck,
+			Crafting:   sess.TurnCraft,
+		}
+		resp, err := h.callModel(r, sess, func(ctx context.Context) (StorytellerResponse, error) {
+			return h.Storyteller.Tell(ctx, systemPrompt, aiRequest)
+		})
+		usage.Add(resp.Usage)
+		if err == nil {
+			var retryUsage TokenUsage
+			var rerun AIResponse
+			rerun, retryUsage, err = h.parseAndRetryAIResponse(r.Context(), systemPrompt, resp.Text)
+			usage.Add(retryUsage)
+			if err == nil {
+				rerunResult := story.Enforce(sess.GameState, rerun.NewGameState, rerun.StoryUpdate.GameOver, rerun.StoryUpdate.ItemsRemoved)
+				if len(rerunResult.Severe()) == 0 {
+					aiResp, result = rerun, rerunResult
+				}
+			}
+		}
+		if err != nil {
+			log.Printf("Re-asking the model for session %s failed, repairing the original turn: %v", sess.ID, err)
+		}
+	}
+
+	for _, c := range result.Corrections {
+		log.Printf("Game state corrected in session %s (%s): %s", sess.ID, c.Invariant, c.Detail)
+		metrics.RecordStateCorrection(c.Invariant, correctionRepaired)
+	}
+	aiResp.StoryUpdate.GameOver = result.GameOver
+	return aiResp, usage
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"story_ai/session"
+	"story_ai/story"
+	"story_ai/templates"
+)
+
+// recordJournal notes the puzzles solved and clues found on the turn just added to the story.
+func recordJournal(sess *session.Session, before *story.GameState, changes story.StateDiff, storyText string) {
+	if sess.Journal == nil {
+		sess.Journal = &story.Journal{}
+	}
+	sess.Journal.Record(len(sess.StoryHistory)-1, before, sess.GameState, changes, storyText)
+}
+
+// journalView returns the journal as the session's player may see it.
+func journalView(sess *session.Session) story.JournalView {
+	return sess.Journal.View(sess.GameState, sess.ShowObjectives)
+}
+
+// ToggleObjectives shows or hides the win conditions in the journal. Only exploratory
+// stories can reveal them; on other difficulties the journal is returned unchanged.
+func (h *Handler) ToggleObjectives(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, _ := h.Manager.GetOrCreateSession(r)
+	if journalView(sess).CanRevealObjectives {
+		sess.ShowObjectives = !sess.ShowObjectives
+	}
+	templates.JournalPanel(journalView(sess), false).Render(r.Context(), w)
+}
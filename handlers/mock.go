@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"story_ai/story"
+	"strings"
+)
+
+// mockRoom is a location in the scripted mock world.
+type mockRoom struct {
+	Description string
+	Exits       map[string]string
+	Objects     []story.WorldObject
+	Items       []story.Item
+}
+
+// mockWorld is the fixed map the MockStoryteller plays through.
+// The player wins by carrying the brass key into the Sealed Vault.
+var mockWorld = map[string]mockRoom{
+	"Reading Room": {
+		Description: "A quiet reading room lit by a single green lamp.",
+		Exits:       map[string]string{"north": "Map Hall", "east": "Stacks"},
+		Objects: []story.WorldObject{
+			{Name: "reading desk", Properties: []string{"wooden", "heavy"}, State: "cluttered"},
+		},
+	},
+	"Stacks": {
+		Description: "Narrow aisles of shelves stretch into the dark.",
+		Exits:       map[string]string{"west": "Reading Room"},
+		Objects: []story.WorldObject{
+			{Name: "dusty shelf", Properties: []string{"wooden", "flammable"}, State: "default"},
+		},
+		Items: []story.Item{
+			{Name: "brass key", Description: "a heavy key stamped with a keyhole sigil", Properties: []string{"metal"}, State: "default"},
+		},
+	},
+	"Map Hall": {
+		Description: "Faded maps cover every wall of this long hall.",
+		Exits:       map[string]string{"south": "Reading Room", "north": "Sealed Vault"},
+		Objects: []story.WorldObject{
+			{Name: "vault door", Properties: []string{"metal", "locked"}, State: "locked"},
+		},
+	},
+	"Sealed Vault": {
+		Description: "A round vault lined with glittering reliquaries.",
+		Exits:       map[string]string{"south": "Map Hall"},
+	},
+}
+
+const (
+	mockStartRoom  = "Reading Room"
+	mockGoalRoom   = "Sealed Vault"
+	mockKeyItem    = "brass key"
+	mockNPCName    = "Archivist Vell"
+	mockNPCDesc    = "the keeper of the archive, patient and watchful"
+	mockTensionCap = 125
+)
+
+// MockStoryteller is a deterministic, offline Storyteller for development.
+// It plays a tiny scripted adventure so the UI can be exercised without an API key.
+type MockStoryteller struct{}
+
+// NewMockStoryteller creates a MockStoryteller.
+func NewMockStoryteller() *MockStoryteller {
+	return &MockStoryteller{}
+}
+
+// Name returns the provider name used in metrics.
+func (m *MockStoryteller) Name() string {
+	return "mock"
+}
+
+// Tell advances the scripted story by one turn and returns AIResponse JSON.
+func (m *MockStoryteller) Tell(ctx context.Context, systemPrompt string, req AIRequest) (StorytellerResponse, error) {
+	// Round-trip through JSON like a real backend, so the caller's state is never mutated.
+	reqText, err := marshalAIRequest(req)
+	if err != nil {
+		return StorytellerResponse{}, err
+	}
+	var turn AIRequest
+	if err := json.Unmarshal([]byte(reqText), &turn); err != nil {
+		return StorytellerResponse{}, err
+	}
+
+	var resp AIResponse
+	if turn.GameState == nil || turn.GameState.Environment.LocationName == "" {
+		resp = mockStart(turn.GameState)
+	} else {
+		resp = mockTurn(turn.GameState, turn.UserAction)
+	}
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		return StorytellerResponse{}, err
+	}
+	return StorytellerResponse{Text: string(out)}, nil
+}
+
+// Correct is never needed because the mock always returns valid JSON.
+func (m *MockStoryteller) Correct(ctx context.Context, systemPrompt string, retryPrompt string) (StorytellerResponse, error) {
+	return StorytellerResponse{}, fmt.Errorf("mock storyteller cannot correct responses")
+}
+
+// mockStart builds the opening scene.
+func mockStart(initial *story.GameState) AIResponse {
+	state := &story.GameState{
+		PlayerStatus:   story.PlayerStatus{Health: 100, Stamina: 100, Conditions: []story.Condition{}},
+		Inventory:      []story.Item{},
+		Rules:          story.Rules{ConsequenceModel: "challenging"},
+		WinConditions:  []string{"Open the Sealed Vault"},
+		LossConditions: []string{"The archive falls silent forever"},
+		NPCs: []story.NPC{
+			{Name: mockNPCName, Disposition: "friendly", Knowledge: []string{}, Goal: "Protect the vault"},
+		},
+		Puzzles: []story.Puzzle{
+			{Name: "Vault Door", Type: "lock_and_key", Description: "The vault door is locked tight.", Status: "unsolved", SolutionHints: []string{"requires_key"}},
+		},
+		ProperNouns:       []story.ProperNoun{{Noun: mockNPCName, PhraseUsed: mockNPCName, Description: mockNPCDesc}},
+		SolvedPuzzleTypes: []string{},
+	}
+	if initial != nil && initial.Rules.ConsequenceModel != "" {
+		state.Rules.ConsequenceModel = initial.Rules.ConsequenceModel
+	}
+	mockEnter(state, mockStartRoom)
+
+	text := "You wake at a reading desk with ink on your fingers. " +
+		mockTooltip(mockNPCName, mockNPCDesc) + " nods toward the north. " +
+		"<em>The vault has not been opened in a century.</em><br><br>" + mockDescribe(state)
+
+	return AIResponse{
+		NewGameState: state,
+		StoryUpdate:  StoryUpdate{Story: text, ItemsAdded: []string{}, ItemsRemoved: []string{}, BackgroundColor: mockColor(0)},
+	}
+}
+
+// mockTurn resolves a single player action against the scripted world.
+func mockTurn(state *story.GameState, action string) AIResponse {
+	update := StoryUpdate{ItemsAdded: []string{}, ItemsRemoved: []string{}}
+	words := strings.Fields(strings.ToLower(action))
+	var outcome string
+
+	switch {
+	case state.Climax:
+		// The turn after the climax always ends the story.
+		state.GameLost = true
+		update.GameOver = true
+		outcome = "The lamps gutter out one by one, and the archive falls silent forever."
+	case mockDirection(state, words) != "":
+		dir := mockDirection(state, words)
+		dest := state.Environment.Exits[dir]
+		if dest == mockGoalRoom && !mockHasItem(state, mockKeyItem) {
+			state.World.WorldTension += 10
+			outcome = "You heave at the vault door, but it will not move without a key."
+			break
+		}
+		mockEnter(state, dest)
+		state.World.WorldTension += 10
+		outcome = fmt.Sprintf("You head %s into the <strong>%s</strong>.", dir, dest)
+		if dest == mockGoalRoom {
+			state.GameWon = true
+			state.Puzzles = []story.Puzzle{}
+			state.SolvedPuzzleTypes = append(state.SolvedPuzzleTypes, "lock_and_key")
+			update.GameOver = true
+			outcome = "The brass key turns with a satisfying click and the vault swings open."
+		}
+	case mockIsTake(words):
+		item, ok := mockTakeable(state, words)
+		if !ok {
+			state.World.WorldTension += 5
+			outcome = "You search, but find nothing here worth taking."
+			break
+		}
+		state.Inventory = append(state.Inventory, item)
+		update.ItemsAdded = append(update.ItemsAdded, item.Name)
+		outcome = fmt.Sprintf(`You pocket the <span class="item-added">%s</span>.`, item.Name)
+	default:
+		state.World.WorldTension += 5
+		outcome = "You pause and take in your surroundings."
+	}
+
+	if state.Rules.ConsequenceModel == "punishing" && state.World.WorldTension >= 60 && !state.GameWon {
+		state.PlayerStatus.Health -= 20
+		outcome += " A falling shelf clips your shoulder."
+	}
+	if state.PlayerStatus.Health <= 0 {
+		state.PlayerStatus.Health = 0
+		state.GameLost = true
+		update.GameOver = true
+	}
+	if state.World.WorldTension >= mockTensionCap {
+		state.Climax = true
+	}
+
+	update.Story = outcome
+	if !update.GameOver {
+		update.Story += "<br><br>" + mockDescribe(state)
+	}
+	update.BackgroundColor = mockColor(state.World.WorldTension)
+	return AIResponse{NewGameState: state, StoryUpdate: update}
+}
+
+// mockEnter moves the player into the named room, leaving behind any items already taken.
+func mockEnter(state *story.GameState, name string) {
+	room := mockWorld[name]
+	exits := make(map[string]string, len(room.Exits))
+	for dir, dest := range room.Exits {
+		exits[dir] = dest
+	}
+	objs := slices.Clone(room.Objects)
+	for _, item := range room.Items {
+		if !mockHasItem(state, item.Name) {
+			objs = append(objs, story.WorldObject{Name: item.Name, Properties: append([]string{"portable"}, item.Properties...), State: item.State})
+		}
+	}
+	state.Environment = story.Environment{LocationName: name, Description: room.Description, Exits: exits, WorldObjects: objs}
+}
+
+// mockDescribe narrates the current room, its objects and exits.
+func mockDescribe(state *story.GameState) string {
+	env := state.Environment
+	var b strings.Builder
+	b.WriteString(env.Description)
+	for _, obj := range env.WorldObjects {
+		fmt.Fprintf(&b, " You notice a %s.", obj.Name)
+	}
+	dirs := make([]string, 0, len(env.Exits))
+	for dir := range env.Exits {
+		dirs = append(dirs, dir)
+	}
+	slices.Sort(dirs)
+	if len(dirs) > 0 {
+		fmt.Fprintf(&b, " Exits lead %s.", strings.Join(dirs, " and "))
+	}
+	return b.String()
+}
+
+// mockDirection returns the exit direction named in the action, if any.
+func mockDirection(state *story.GameState, words []string) string {
+	for _, w := range words {
+		if _, ok := state.Environment.Exits[w]; ok {
+			return w
+		}
+	}
+	return ""
+}
+
+func mockIsTake(words []string) bool {
+	return len(words) > 0 && (words[0] == "take" || words[0] == "grab" || words[0] == "get" || words[0] == "pick")
+}
+
+// mockTakeable finds a portable object in the room that the action refers to and removes it.
+func mockTakeable(state *story.GameState, words []string) (story.Item, bool) {
+	for i, obj := range state.Environment.WorldObjects {
+		if !slices.Contains(obj.Properties, "portable") {
+			continue
+		}
+		for _, w := range words[1:] {
+			if strings.Contains(obj.Name, w) && len(w) > 2 {
+				state.Environment.WorldObjects = slices.Delete(state.Environment.WorldObjects, i, i+1)
+				for _, room := range mockWorld {
+					for _, item := range room.Items {
+						if item.Name == obj.Name {
+							return item, true
+						}
+					}
+				}
+			}
+		}
+	}
+	return story.Item{}, false
+}
+
+func mockHasItem(state *story.GameState, name string) bool {
+	for _, item := range state.Inventory {
+		if item.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func mockTooltip(phrase, desc string) string {
+	return fmt.Sprintf(`<span class="proper-noun tooltip" tabindex="0">%s<span class="tooltiptext">%s</span></span>`, phrase, desc)
+}
+
+// mockColor darkens the background as tension rises.
+func mockColor(tension int) string {
+	switch {
+	case tension >= 80:
+		return "#3b1f2b"
+	case tension >= 40:
+		return "#2e2a3b"
+	default:
+		return "#1e2a2e"
+	}
+}
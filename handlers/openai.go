@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultOpenAIBaseURL points at a llama.cpp server running on its default port.
+const DefaultOpenAIBaseURL = "http://localhost:8080/v1"
+
+// OpenAIStoryteller is a Storyteller for servers that speak the OpenAI
+// /v1/chat/completions protocol (llama.cpp, Ollama, vLLM, ...).
+type OpenAIStoryteller struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+// OpenAIAPIError is returned when the server answers with a non-200 status.
+type OpenAIAPIError struct {
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration // From the Retry-After header, if the server sent one
+}
+
+func (e *OpenAIAPIError) Error() string {
+	return fmt.Sprintf("openai-compatible server returned %d: %s", e.StatusCode, e.Message)
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIResponseFormat struct {
+	Type string `json:"type"`
+}
+
+type openAIChatRequest struct {
+	Model          string               `json:"model"`
+	Messages       []openAIMessage      `json:"messages"`
+	Temperature    float32              `json:"temperature"`
+	ResponseFormat openAIResponseFormat `json:"response_format"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// NewOpenAIStoryteller creates a Storyteller for an OpenAI-compatible server.
+// baseURL should include the version prefix, e.g. "http://localhost:11434/v1".
+func NewOpenAIStoryteller(baseURL, apiKey, model string) *OpenAIStoryteller {
+	if baseURL == "" {
+		baseURL = DefaultOpenAIBaseURL
+	}
+	return &OpenAIStoryteller{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client:  &http.Client{Timeout: 120 * time.Second},
+	}
+}
+
+// Name returns the provider name used in metrics.
+func (o *OpenAIStoryteller) Name() string {
+	return "openai"
+}
+
+// Tell sends the system prompt as a system message and the marshalled AIRequest as a user message.
+func (o *OpenAIStoryteller) Tell(ctx context.Context, systemPrompt string, req AIRequest) (StorytellerResponse, error) {
+	reqText, err := marshalAIRequest(req)
+	if err != nil {
+		return StorytellerResponse{}, err
+	}
+	return o.complete(ctx, systemPrompt, reqText)
+}
+
+// Correct sends a JSON correction prompt as the user message.
+func (o *OpenAIStoryteller) Correct(ctx context.Context, systemPrompt string, retryPrompt string) (StorytellerResponse, error) {
+	return o.complete(ctx, systemPrompt, retryPrompt)
+}
+
+func (o *OpenAIStoryteller) complete(ctx context.Context, systemPrompt string, userMessage string) (StorytellerResponse, error) {
+	chatReq := openAIChatRequest{
+		Model:          o.model,
+		Temperature:    0.9,
+		ResponseFormat: openAIResponseFormat{Type: "json_object"},
+	}
+	if systemPrompt != "" {
+		chatReq.Messages = append(chatReq.Messages, openAIMessage{Role: "system", Content: systemPrompt})
+	}
+	chatReq.Messages = append(chatReq.Messages, openAIMessage{Role: "user", Content: userMessage})
+
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return StorytellerResponse{}, fmt.Errorf("failed to marshal chat request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, o.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return StorytellerResponse{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := o.client.Do(httpReq)
+	if err != nil {
+		return StorytellerResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return StorytellerResponse{}, fmt.Errorf("failed to read chat response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return StorytellerResponse{}, &OpenAIAPIError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(respBody)),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	var chatResp openAIChatResponse
+	if err := json.Unmarshal(respBody, &chatResp); err != nil {
+		return StorytellerResponse{}, fmt.Errorf("failed to decode chat response: %w", err)
+	}
+	if len(chatResp.Choices) > 0 && chatResp.Choices[0].FinishReason == "content_filter" {
+		return StorytellerResponse{}, fmt.Errorf("openai-compatible server stopped with finish_reason content_filter: %w", errContentBlocked)
+	}
+	if len(chatResp.Choices) == 0 || chatResp.Choices[0].Message.Content == "" {
+		return StorytellerResponse{}, fmt.Errorf("openai-compatible server returned an empty response")
+	}
+
+	return StorytellerResponse{
+		Text: chatResp.Choices[0].Message.Content,
+		Usage: TokenUsage{
+			PromptTokens:    chatResp.Usage.PromptTokens,
+			CandidateTokens: chatResp.Usage.CompletionTokens,
+			TotalTokens:     chatResp.Usage.TotalTokens,
+		},
+	}, nil
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import "strings"
+
+// JSON repair strategies, reported to metrics when they change a response.
+const (
+	repairExtractObject  = "extract_object"
+	repairTrailingCommas = "remove_trailing_commas"
+	repairCloseString    = "close_string"
+	repairCloseBrackets  = "close_brackets"
+)
+
+// repairJSON fixes common, mechanical problems in model output without another
+// model call: prose or code fences around the object, trailing commas, and
+// responses truncated before their closing quotes and brackets.
+// It returns the repaired text and the strategies that changed it.
+func repairJSON(raw string) (string, []string) {
+	var applied []string
+	text := raw
+
+	if extracted, ok := extractJSONObject(text); ok && extracted != text {
+		text = extracted
+		applied = append(applied, repairExtractObject)
+	}
+
+	if cleaned := removeTrailingCommas(text); cleaned != text {
+		text = cleaned
+		applied = append(applied, repairTrailingCommas)
+	}
+
+	closed, closedString, closedBrackets := closeUnbalanced(text)
+	if closedString {
+		applied = append(applied, repairCloseString)
+	}
+	if closedBrackets {
+		applied = append(applied, repairCloseBrackets)
+	}
+	text = closed
+
+	return text, applied
+}
+
+// extractJSONObject returns the outermost JSON object in text. If the object is
+// never closed, everything from its opening brace onward is returned.
+func extractJSONObject(text string) (string, bool) {
+	start := strings.Index(text, "{")
+	if start == -1 {
+		return "", false
+	}
+
+	depth := 0
+	inString := false
+	escaped := false
+	for i := start; i < len(text); i++ {
+		c := text[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return text[start : i+1], true
+			}
+		}
+	}
+	return strings.TrimSpace(text[start:]), true
+}
+
+// removeTrailingCommas drops commas that directly precede a closing bracket.
+func removeTrailingCommas(text string) string {
+	var b strings.Builder
+	inString := false
+	escaped := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			b.WriteByte(c)
+			continue
+		}
+		if c == '"' {
+			inString = true
+		}
+		if c == ',' {
+			next := strings.TrimLeft(text[i+1:], " \t\r\n")
+			if next == "" || next[0] == '}' || next[0] == ']' {
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// closeUnbalanced terminates an open string and appends any missing closing brackets.
+func closeUnbalanced(text string) (string, bool, bool) {
+	var stack []byte
+	inString := false
+	escaped := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			stack = append(stack, '}')
+		case '[':
+			stack = append(stack, ']')
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+
+	closedString := false
+	if inString {
+		if escaped {
+			text = text[:len(text)-1]
+		}
+		text += `"`
+		closedString = true
+	}
+	if len(stack) == 0 {
+		return text, closedString, false
+	}
+
+	// A value cut off after its key or separator cannot be completed; drop the dangling part.
+	trimmed := strings.TrimRight(text, " \t\r\n")
+	switch {
+	case strings.HasSuffix(trimmed, ":"):
+		trimmed += "null"
+	case strings.HasSuffix(trimmed, ","):
+		trimmed = trimmed[:len(trimmed)-1]
+	}
+
+	var b strings.Builder
+	b.WriteString(trimmed)
+	for i := len(stack) - 1; i >= 0; i-- {
+		b.WriteByte(stack[i])
+	}
+	return b.String(), closedString, true
+}
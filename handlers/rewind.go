@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"story_ai/metrics"
+	"story_ai/session"
+	"story_ai/story"
+	"story_ai/templates"
+	"strconv"
+)
+
+// canRewind reports whether the session's story may still be rewound on its difficulty.
+func canRewind(sess *session.Session) bool {
+	limit := story.RewindLimit(sess.GameState.Rules.ConsequenceModel)
+	return limit < 0 || sess.Rewinds < limit
+}
+
+// Rewind restores the session to the state it was in after an earlier turn, dropping
+// every page that came after it.
+func (h *Handler) Rewind(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, _ := h.Manager.GetOrCreateSession(r)
+
+	turn, err := strconv.Atoi(r.FormValue("turn"))
+	if err != nil || turn < 0 || turn >= len(sess.StoryHistory)-1 || sess.StoryHistory[turn].State == nil {
+		http.Error(w, "There is no such turn to rewind to.", http.StatusBadRequest)
+		return
+	}
+	if !canRewind(sess) {
+		http.Error(w, "This story can no longer be rewound.", http.StatusForbidden)
+		return
+	}
+
+	wasOver := sess.GameState.GameWon || sess.GameState.GameLost
+	rewindSession(sess, turn)
+	metrics.RecordRewind(sess.GameState.Rules.ConsequenceModel)
+
+	templates.Update(sess.StoryHistory, sess.GameState.PlayerStatus, sess.GameState.Inventory, "#1e1e1e", false, false, sess.CurrentGenre, sess.GameState.Rules.ConsequenceModel, sess.GameState.World.WorldTension, sess.CurrentAuthor, sess.TotalTokens, sess.WorldMap, journalView(sess), canRewind(sess)).Render(r.Context(), w)
+	if wasOver {
+		// The game-over buttons replaced the prompt box; bring it back.
+		templates.ResponseForm(sess.GameState.Rules.ConsequenceModel, placeholderFor(sess.NarratorPersona), true).Render(r.Context(), w)
+	}
+}
+
+// rewindSession restores the game state snapshotted with the given page and rebuilds
+// the rooms, map and journal from the pages that remain.
+func rewindSession(sess *session.Session, turn int) {
+	sess.StoryHistory = sess.StoryHistory[:turn+1]
+	sess.GameState = sess.StoryHistory[turn].State.Clone()
+	sess.PendingAction = ""
+	sess.Rewinds++
+	rebuildRooms(sess)
+	sess.Journal.Rewind(turn)
+}
+
+// rebuildRooms recomputes the offline engine's rooms and the world map from the
+// snapshots on the session's story pages.
+func rebuildRooms(sess *session.Session) {
+	engine := &OfflineEngine{}
+	sess.WorldMap = &story.WorldMap{}
+	for _, page := range sess.StoryHistory {
+		if page.State != nil {
+			engine.remember(page.State.Environment)
+			sess.WorldMap.Visit(page.State.Environment)
+		}
+	}
+	sess.KnownRooms = engine.Rooms
+}
@@ -1,37 +1,102 @@
 package handlers
 
-import "github.com/google/generative-ai-go/genai"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// hexColorRegex matches the "#rrggbb" colors the prompts ask for.
+var hexColorRegex = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// SchemaViolation describes a single field of an AIResponse that is missing or malformed.
+type SchemaViolation struct {
+	Field   string
+	Problem string
+}
+
+func (v SchemaViolation) String() string {
+	return fmt.Sprintf("%s: %s", v.Field, v.Problem)
+}
+
+// SchemaError is returned by parseAIResponse when the JSON is well-formed
+// but does not satisfy the response schema.
+type SchemaError struct {
+	Violations []SchemaViolation
+}
+
+func (e *SchemaError) Error() string {
+	problems := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		problems[i] = v.String()
+	}
+	return "AI response does not match the schema: " + strings.Join(problems, "; ")
+}
 
 // BuildAIResponseSchema constructs the JSON schema expected from the model.
 func BuildAIResponseSchema() *genai.Schema {
 	return &genai.Schema{
-		Type: genai.TypeObject,
+		Type:     genai.TypeObject,
+		Required: []string{"new_game_state", "story_update"},
 		Properties: map[string]*genai.Schema{
 			"new_game_state": {
-				Type: genai.TypeObject,
+				Type:     genai.TypeObject,
+				Required: []string{"status", "env", "world", "rules", "climax", "won", "lost"},
 				Properties: map[string]*genai.Schema{
+					"char": {
+						Type: genai.TypeObject,
+						Properties: map[string]*genai.Schema{
+							"name":   {Type: genai.TypeString},
+							"role":   {Type: genai.TypeString},
+							"traits": {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+						},
+					},
 					"status": {
 						Type: genai.TypeObject,
 						Properties: map[string]*genai.Schema{
-							"hp":    {Type: genai.TypeInteger},
-							"sp":    {Type: genai.TypeInteger},
-							"conds": {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+							"hp": {Type: genai.TypeInteger},
+							"sp": {Type: genai.TypeInteger},
+							"conds": {
+								Type: genai.TypeArray,
+								Items: &genai.Schema{
+									Type:     genai.TypeObject,
+									Required: []string{"name"},
+									Properties: map[string]*genai.Schema{
+										"name":  {Type: genai.TypeString},
+										"sev":   {Type: genai.TypeInteger},
+										"turns": {Type: genai.TypeInteger},
+										"hp":    {Type: genai.TypeInteger},
+										"sp":    {Type: genai.TypeInteger},
+									},
+								},
+							},
 						},
 					},
 					"inv": {
 						Type: genai.TypeArray,
 						Items: &genai.Schema{
-							Type: genai.TypeObject,
+							Type:     genai.TypeObject,
+							Required: []string{"name", "desc"},
 							Properties: map[string]*genai.Schema{
-								"name":  {Type: genai.TypeString},
-								"desc":  {Type: genai.TypeString},
-								"props": {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
-								"state": {Type: genai.TypeString},
+								"name":     {Type: genai.TypeString},
+								"desc":     {Type: genai.TypeString},
+								"props":    {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+								"state":    {Type: genai.TypeString},
+								"charges":  {Type: genai.TypeInteger},
+								"dur":      {Type: genai.TypeInteger},
+								"slot":     {Type: genai.TypeString},
+								"equipped": {Type: genai.TypeBoolean},
+								"wt":       {Type: genai.TypeInteger},
 							},
 						},
 					},
 					"env": {
-						Type: genai.TypeObject,
+						Type:     genai.TypeObject,
+						Required: []string{"loc", "desc"},
 						Properties: map[string]*genai.Schema{
 							"loc":  {Type: genai.TypeString},
 							"desc": {Type: genai.TypeString},
@@ -99,7 +164,8 @@ func BuildAIResponseSchema() *genai.Schema {
 					"nouns": {
 						Type: genai.TypeArray,
 						Items: &genai.Schema{
-							Type: genai.TypeObject,
+							Type:     genai.TypeObject,
+							Required: []string{"noun", "phrase", "desc"},
 							Properties: map[string]*genai.Schema{
 								"noun":   {Type: genai.TypeString},
 								"phrase": {Type: genai.TypeString},
@@ -111,6 +177,7 @@ func BuildAIResponseSchema() *genai.Schema {
 						Type: genai.TypeObject,
 						Properties: map[string]*genai.Schema{
 							"model": {Type: genai.TypeString},
+							"carry": {Type: genai.TypeInteger},
 						},
 					},
 					"climax":         {Type: genai.TypeBoolean},
@@ -122,7 +189,8 @@ func BuildAIResponseSchema() *genai.Schema {
 				},
 			},
 			"story_update": {
-				Type: genai.TypeObject,
+				Type:     genai.TypeObject,
+				Required: []string{"story", "items_added", "items_removed", "game_over", "background_color"},
 				Properties: map[string]*genai.Schema{
 					"story":            {Type: genai.TypeString},
 					"items_added":      {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
@@ -134,3 +202,90 @@ func BuildAIResponseSchema() *genai.Schema {
 		},
 	}
 }
+
+// validateAIResponseSchema reports every required field of the response that is missing or malformed.
+func validateAIResponseSchema(resp AIResponse) []SchemaViolation {
+	var violations []SchemaViolation
+	add := func(field, problem string) {
+		violations = append(violations, SchemaViolation{Field: field, Problem: problem})
+	}
+
+	if strings.TrimSpace(resp.StoryUpdate.Story) == "" {
+		add("story_update.story", "is missing or empty")
+	}
+	if color := resp.StoryUpdate.BackgroundColor; color != "" && !hexColorRegex.MatchString(color) {
+		add("story_update.background_color", fmt.Sprintf("%q is not a #rrggbb hex color", color))
+	}
+
+	state := resp.NewGameState
+	if state == nil {
+		add("new_game_state", "is missing or null")
+		return violations
+	}
+	if state.Environment.LocationName == "" {
+		add("new_game_state.env.loc", "is missing or empty")
+	}
+	if state.Rules.ConsequenceModel == "" {
+		add("new_game_state.rules.model", "is missing or empty")
+	}
+	for i, condition := range state.PlayerStatus.Conditions {
+		if condition.Name == "" {
+			add(fmt.Sprintf("new_game_state.status.conds[%d].name", i), "is empty")
+		}
+	}
+	for i, item := range state.Inventory {
+		if item.Name == "" {
+			add(fmt.Sprintf("new_game_state.inv[%d].name", i), "is empty")
+		}
+		if item.Description == "" {
+			add(fmt.Sprintf("new_game_state.inv[%d].desc", i), "is empty")
+		}
+	}
+	for i, obj := range state.Environment.WorldObjects {
+		if obj.Name == "" {
+			add(fmt.Sprintf("new_game_state.env.objs[%d].name", i), "is empty")
+		}
+	}
+	for i, npc := range state.NPCs {
+		if npc.Name == "" {
+			add(fmt.Sprintf("new_game_state.npcs[%d].name", i), "is empty")
+		}
+	}
+	for i, puzzle := range state.Puzzles {
+		if puzzle.Name == "" {
+			add(fmt.Sprintf("new_game_state.puzzles[%d].name", i), "is empty")
+		}
+	}
+	for i, noun := range state.ProperNouns {
+		if noun.Noun == "" {
+			add(fmt.Sprintf("new_game_state.nouns[%d].noun", i), "is empty")
+		}
+		if noun.PhraseUsed == "" {
+			add(fmt.Sprintf("new_game_state.nouns[%d].phrase", i), "is empty")
+		}
+		if noun.Description == "" {
+			add(fmt.Sprintf("new_game_state.nouns[%d].desc", i), "is empty")
+		}
+	}
+
+	return violations
+}
+
+// describeResponseProblems lists what was wrong with a response, for use in the JSON retry prompt.
+func describeResponseProblems(err error) string {
+	var schemaErr *SchemaError
+	if errors.As(err, &schemaErr) {
+		lines := make([]string, len(schemaErr.Violations))
+		for i, v := range schemaErr.Violations {
+			lines[i] = "- " + v.String()
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Sprintf("- %s: expected %s but got a JSON %s", typeErr.Field, typeErr.Type, typeErr.Value)
+	}
+
+	return fmt.Sprintf("- the response is not valid JSON: %v", err)
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"html"
+	"log"
+	"slices"
+	"story_ai/metrics"
+	"story_ai/session"
+	"story_ai/story"
+	"strings"
+)
+
+// statusDeathText ends the story when a condition or overexertion takes the player's last hp.
+const statusDeathText = "<p><em>Your body gives out. You can go no further.</em></p>"
+
+// settleTurn tells the player what the server did to their status and items at the end
+// of the turn, already applied to the response, and enforces the invariants again,
+// since a tick can take the player's last hp.
+func settleTurn(sess *session.Session, aiResp AIResponse, tick story.StatusTick, items story.ItemChanges) AIResponse {
+	if !tick.Empty() {
+		log.Printf("Status ticked in session %s: spent %d sp, recovered %d sp, strain %d hp, effects %v, wore off %v",
+			sess.ID, tick.Spent, tick.Recovered, tick.Strain, tick.Effects, tick.WoreOff)
+	}
+
+	if !items.Empty() {
+		log.Printf("Items settled in session %s: used up %v, broken %v, left behind %v, unequipped %v",
+			sess.ID, items.UsedUp, items.Broken, items.LeftBehind, items.Unequipped)
+		aiResp.StoryUpdate.ItemsRemoved = append(aiResp.StoryUpdate.ItemsRemoved, items.Removed()...)
+		aiResp.StoryUpdate.ItemsAdded = slices.DeleteFunc(aiResp.StoryUpdate.ItemsAdded, func(name string) bool {
+			return slices.ContainsFunc(items.LeftBehind, func(left string) bool { return strings.EqualFold(left, name) })
+		})
+		aiResp.StoryUpdate.Story += "<p><em>" + html.EscapeString(strings.Join(items.Narration(), " ")) + "</em></p>"
+	}
+
+	wasOver := aiResp.StoryUpdate.GameOver
+	result := story.Enforce(sess.GameState, aiResp.NewGameState, aiResp.StoryUpdate.GameOver, aiResp.StoryUpdate.ItemsRemoved)
+	for _, c := range result.Corrections {
+		log.Printf("Game state corrected in session %s after the status tick (%s): %s", sess.ID, c.Invariant, c.Detail)
+		metrics.RecordStateCorrection(c.Invariant, correctionRepaired)
+	}
+	aiResp.StoryUpdate.GameOver = result.GameOver
+	if result.GameOver && !wasOver {
+		aiResp.StoryUpdate.Story += statusDeathText
+	}
+	return aiResp
+}
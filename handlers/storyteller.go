@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Storyteller is a language model backend that drives the game.
+// Implementations receive the assembled system prompt and either the current
+// turn or a free-form correction prompt, and return the model's raw text.
+type Storyteller interface {
+	// Name identifies the backend in logs and metrics (e.g. "gemini").
+	Name() string
+	// Tell sends a single game turn to the model.
+	Tell(ctx context.Context, systemPrompt string, req AIRequest) (StorytellerResponse, error)
+	// Correct asks the model to repair a previous, malformed response.
+	Correct(ctx context.Context, systemPrompt string, retryPrompt string) (StorytellerResponse, error)
+}
+
+// StreamingStoryteller is implemented by backends that can deliver a turn incrementally.
+type StreamingStoryteller interface {
+	Storyteller
+	// TellStream behaves like Tell, but calls onText with the accumulated raw text
+	// every time more of the response arrives. A stream that fails part way returns the
+	// usage reported so far along with the error.
+	TellStream(ctx context.Context, systemPrompt string, req AIRequest, onText func(raw string)) (StorytellerResponse, error)
+}
+
+// DiceSeeder is implemented by storytellers that record or replay each story's dice seed,
+// so a replayed story rolls the same skill checks, and sends the same requests, as the
+// recorded one.
+type DiceSeeder interface {
+	// DiceSeed returns the seed a new story should use, given a freshly drawn one.
+	DiceSeed(fresh uint64) uint64
+}
+
+// StorytellerResponse is the raw text returned by a Storyteller along with its token usage.
+type StorytellerResponse struct {
+	Text  string
+	Usage TokenUsage
+}
+
+// TokenUsage reports the tokens consumed by a single model call.
+type TokenUsage struct {
+	PromptTokens    int `json:"prompt_tokens"`
+	CandidateTokens int `json:"candidate_tokens"`
+	TotalTokens     int `json:"total_tokens"`
+}
+
+// Add accumulates another call's usage into u.
+func (u *TokenUsage) Add(other TokenUsage) {
+	u.PromptTokens += other.PromptTokens
+	u.CandidateTokens += other.CandidateTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// marshalAIRequest encodes the turn sent to the model as JSON.
+func marshalAIRequest(req AIRequest) (string, error) {
+	reqBytes, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal AI request: %w", err)
+	}
+	return string(reqBytes), nil
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// storyKeyRegex finds the start of the "story" string in a (possibly incomplete) AI response.
+var storyKeyRegex = regexp.MustCompile(`"story"\s*:\s*"`)
+
+// Stream delivers the pending turn as Server-Sent Events. "chunk" events carry the
+// story text generated so far; the final "done" event carries the same out-of-band
+// update that Generate renders for non-streaming backends.
+func (h *Handler) Stream(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	sess, _ := h.Manager.GetOrCreateSession(r)
+
+	streamer, ok := h.Storyteller.(StreamingStoryteller)
+	userAction := sess.PendingAction
+	if !ok || userAction == "" {
+		// 204 tells the browser's EventSource not to reconnect.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	sess.PendingAction = ""
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported.", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	systemPrompt := h.buildSystemPrompt(sess)
+	aiRequest := AIRequest{
+		GameState:  sess.GameState,
+		UserAction: modelAction(sess.ID, userAction),
+		SkillCheck: rollCheck(sess, userAction),
+		Crafting:   h.planCraft(sess, userAction),
+	}
+
+	lastSent := ""
+	// Each chunk carries the whole story so far, so a retried stream simply starts over.
+	resp, err := h.callModel(r, sess, func(ctx context.Context) (StorytellerResponse, error) {
+		return streamer.TellStream(ctx, systemPrompt, aiRequest, func(raw string) {
+			partial := partialStoryText(raw)
+			if partial == lastSent {
+				return
+			}
+			lastSent = partial
+			writeSSEEvent(w, "chunk", partial)
+			flusher.Flush()
+		})
+	})
+
+	// The final update is rendered into a buffer so the existing handlers can be reused.
+	final := newBufferedResponse()
+	if err != nil {
+		h.handleAIError(final, r, sess, userAction, err, startTime)
+	} else {
+		h.finishTurn(final, r, sess, userAction, systemPrompt, resp, startTime)
+	}
+	writeSSEEvent(w, "done", final.body.String())
+	flusher.Flush()
+}
+
+// partialStoryText extracts the story text received so far from an incomplete AI response.
+// Any trailing, half-written HTML tag is dropped so the browser never renders it as text.
+func partialStoryText(raw string) string {
+	loc := storyKeyRegex.FindStringIndex(raw)
+	if loc == nil {
+		return ""
+	}
+	rest := raw[loc[1]:]
+
+	// Find the end of the JSON string, stopping early at an incomplete escape sequence.
+	end := 0
+	for end < len(rest) {
+		c := rest[end]
+		if c == '"' {
+			break
+		}
+		if c == '\\' {
+			if end+1 >= len(rest) {
+				break
+			}
+			if rest[end+1] == 'u' {
+				if end+6 > len(rest) {
+					break
+				}
+				end += 6
+				continue
+			}
+			end += 2
+			continue
+		}
+		end++
+	}
+
+	var text string
+	if err := json.Unmarshal([]byte(`"`+rest[:end]+`"`), &text); err != nil {
+		return ""
+	}
+	if open := strings.LastIndex(text, "<"); open > strings.LastIndex(text, ">") {
+		text = text[:open]
+	}
+	// Violations are reported once the whole story is stored, not for every chunk.
+	text, _ = sanitizeHTMLContent(text)
+	return text
+}
+
+// writeSSEEvent writes a single Server-Sent Event, splitting multi-line data as the protocol requires.
+func writeSSEEvent(w io.Writer, event string, data string) {
+	fmt.Fprintf(w, "event: %s\n", event)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
+
+// bufferedResponse is an http.ResponseWriter that captures the rendered body.
+type bufferedResponse struct {
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
@@ -2,98 +2,169 @@ package handlers
 
 import (
 	"fmt"
-	"regexp"
+	"log"
+	"story_ai/metrics"
 	"strings"
-	"unicode"
+
+	"golang.org/x/net/html"
 )
 
-// validateAIResponse validates AI response content for security and appropriateness
-func validateAIResponse(response string) error {
-	// Check for script injection attempts
-	dangerousPatterns := []string{
-		`<script`, `javascript:`, `on\w+\s*=`, `<iframe`, `<object`, `<embed`,
-		`eval\s*\(`, `document\.`, `window\.`, `alert\s*\(`, `prompt\s*\(`,
-		`confirm\s*\(`, `setTimeout\s*\(`, `setInterval\s*\(`,
-		`<img[^>]*src\s*=\s*["'][^"']*javascript:`,
-	}
+// storyAllowedTags are the elements the prompts ask the model to use in story text.
+var storyAllowedTags = map[string]bool{"strong": true, "em": true, "br": true, "span": true}
 
-	responseLower := strings.ToLower(response)
-	for _, pattern := range dangerousPatterns {
-		if strings.Contains(responseLower, pattern) {
-			return fmt.Errorf("AI response contains potentially harmful content")
-		}
-	}
+// storyAllowedClasses are the span classes the prompts and templates use.
+var storyAllowedClasses = map[string]bool{"proper-noun": true, "tooltip": true, "tooltiptext": true, "item-added": true, "item-removed": true}
 
-	// Check for excessive special characters (might indicate encoding issues)
-	specialChars := 0
-	for _, char := range response {
-		if !unicode.IsLetter(char) && !unicode.IsDigit(char) && !unicode.IsSpace(char) && !unicode.IsPunct(char) {
-			specialChars++
-		}
-	}
-	if specialChars > len(response)/5 { // More than 20% special characters
-		return fmt.Errorf("AI response contains too many special characters")
-	}
+// storyDroppedContent are elements whose content is discarded along with the tag.
+var storyDroppedContent = map[string]bool{"script": true, "style": true, "iframe": true, "object": true, "embed": true, "noscript": true, "template": true, "textarea": true, "title": true, "svg": true, "math": true}
 
-	// Check response length
-	if len(response) > 10000 { // 10KB limit
-		return fmt.Errorf("AI response is too long")
-	}
-	if len(response) < 10 { // Minimum length
-		return fmt.Errorf("AI response is too short")
-	}
+// storyTextEscaper escapes text content; quotes only need escaping inside attributes.
+var storyTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
 
-	// Check for proper JSON structure if it contains JSON
-	jsonPattern := regexp.MustCompile(`\{.*\}`)
-	if jsonPattern.MatchString(response) {
-		// Basic JSON validation - check for balanced braces
-		openBraces := strings.Count(response, "{")
-		closeBraces := strings.Count(response, "}")
-		if openBraces != closeBraces {
-			return fmt.Errorf("AI response contains malformed JSON structure")
+// SanitizerViolation is a piece of markup removed from story text.
+type SanitizerViolation struct {
+	Kind    string // "tag", "attribute", "class" or "comment"
+	Element string
+}
+
+// sanitizeHTMLContent rebuilds AI story markup from an HTML tokenizer, keeping only the
+// allowed tags, span classes and tabindex. Disallowed tags are removed but their text is
+// kept (escaped), except for elements like script whose content is dropped entirely.
+// Unclosed allowed tags are closed at the end so one page cannot break the next.
+func sanitizeHTMLContent(content string) (string, []SanitizerViolation) {
+	var out strings.Builder
+	var violations []SanitizerViolation
+	var open []string
+	skipping := ""
+	skipDepth := 0
+
+	z := html.NewTokenizer(strings.NewReader(content))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
 		}
-	}
+		tok := z.Token()
+		name := tok.Data
 
-	// Check for excessive repetition (might indicate AI hallucination)
-	words := strings.Fields(response)
-	if len(words) > 10 {
-		wordCount := make(map[string]int)
-		for _, word := range words {
-			word = strings.ToLower(strings.Trim(word, ".,!?"))
-			if len(word) > 3 { // Only count meaningful words
-				wordCount[word]++
+		if skipping != "" {
+			switch {
+			case tt == html.StartTagToken && name == skipping:
+				skipDepth++
+			case tt == html.EndTagToken && name == skipping:
+				skipDepth--
+				if skipDepth == 0 {
+					skipping = ""
+				}
 			}
+			continue
 		}
 
-		maxRepetition := 0
-		for _, count := range wordCount {
-			if count > maxRepetition {
-				maxRepetition = count
+		switch tt {
+		case html.TextToken:
+			out.WriteString(storyTextEscaper.Replace(tok.Data))
+
+		case html.CommentToken, html.DoctypeToken:
+			violations = append(violations, SanitizerViolation{Kind: "comment", Element: "comment"})
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if !storyAllowedTags[name] {
+				violations = append(violations, SanitizerViolation{Kind: "tag", Element: name})
+				if storyDroppedContent[name] && tt == html.StartTagToken {
+					skipping, skipDepth = name, 1
+				}
+				continue
+			}
+			out.WriteString("<" + name)
+			for _, attr := range tok.Attr {
+				value, ok := sanitizeStoryAttribute(name, attr, &violations)
+				if ok {
+					out.WriteString(fmt.Sprintf(` %s="%s"`, attr.Key, html.EscapeString(value)))
+				}
+			}
+			out.WriteString(">")
+			if name != "br" && tt == html.StartTagToken {
+				open = append(open, name)
 			}
-		}
 
-		// If any word is repeated more than 10% of the time, flag it
-		if maxRepetition > len(words)/10 && maxRepetition > 3 {
-			return fmt.Errorf("AI response contains excessive word repetition")
+		case html.EndTagToken:
+			if !storyAllowedTags[name] {
+				continue
+			}
+			// Close anything still open inside this element, then the element itself.
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == name {
+					for j := len(open) - 1; j >= i; j-- {
+						out.WriteString("</" + open[j] + ">")
+					}
+					open = open[:i]
+					break
+				}
+			}
 		}
 	}
-
-	return nil
+	for i := len(open) - 1; i >= 0; i-- {
+		out.WriteString("</" + open[i] + ">")
+	}
+	return out.String(), violations
 }
 
-// sanitizeHTMLContent sanitizes HTML content in AI responses
-func sanitizeHTMLContent(content string) string {
-	// Remove any script tags that might have slipped through
-	scriptRegex := regexp.MustCompile(`(?i)<script[^>]*>.*?</script>`)
-	content = scriptRegex.ReplaceAllString(content, "")
-
-	// Remove javascript: URLs
-	jsURLRegex := regexp.MustCompile(`(?i)javascript:[^\s"']*`)
-	content = jsURLRegex.ReplaceAllString(content, "#")
+// sanitizeStoryAttribute returns the cleaned value of an attribute and whether to keep it.
+func sanitizeStoryAttribute(tag string, attr html.Attribute, violations *[]SanitizerViolation) (string, bool) {
+	if tag != "span" || attr.Namespace != "" {
+		*violations = append(*violations, SanitizerViolation{Kind: "attribute", Element: tag + "@" + attr.Key})
+		return "", false
+	}
+	switch attr.Key {
+	case "class":
+		var kept []string
+		for _, class := range strings.Fields(attr.Val) {
+			if storyAllowedClasses[class] {
+				kept = append(kept, class)
+			} else {
+				*violations = append(*violations, SanitizerViolation{Kind: "class", Element: class})
+			}
+		}
+		return strings.Join(kept, " "), len(kept) > 0
+	case "tabindex":
+		if attr.Val == "0" || attr.Val == "-1" {
+			return attr.Val, true
+		}
+	}
+	*violations = append(*violations, SanitizerViolation{Kind: "attribute", Element: tag + "@" + attr.Key})
+	return "", false
+}
 
-	// Remove event handlers
-	eventRegex := regexp.MustCompile(`(?i)on\w+\s*=\s*["'][^"']*["']`)
-	content = eventRegex.ReplaceAllString(content, "")
+// metricElement is the label a violation is counted under. The model chooses the names,
+// so any not on the sanitizer's own lists is counted as "other".
+func metricElement(v SanitizerViolation) string {
+	known := func(name string) string {
+		if storyAllowedTags[name] || storyDroppedContent[name] || storyAllowedClasses[name] {
+			return name
+		}
+		return "other"
+	}
+	switch v.Kind {
+	case "attribute":
+		tag, key, _ := strings.Cut(v.Element, "@")
+		if key != "class" && key != "tabindex" {
+			key = "other"
+		}
+		return known(tag) + "@" + key
+	case "comment":
+		return v.Element
+	}
+	return known(v.Element)
+}
 
-	return content
+// sanitizeStoryText cleans story markup before it is stored and reports what was removed.
+func sanitizeStoryText(content string) string {
+	clean, violations := sanitizeHTMLContent(content)
+	for _, v := range violations {
+		metrics.RecordHTMLSanitized(v.Kind, metricElement(v))
+	}
+	if len(violations) > 0 {
+		log.Printf("Removed %d disallowed markup items from story text", len(violations))
+	}
+	return clean
 }
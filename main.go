@@ -2,13 +2,17 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"story_ai/handlers"
 	"story_ai/metrics"
 	"story_ai/session"
+	"story_ai/story"
 	"story_ai/templates"
 
 	"github.com/google/generative-ai-go/genai"
@@ -28,17 +32,48 @@ func main() {
 	metrics.InitDefaultCollector(metricsURL)
 
 	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(os.Getenv("GEMINI_API_KEY")))
+	storyteller, closeStoryteller, err := newStoryteller(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer closeStoryteller()
+
+	budget, err := newTokenBudget()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	callTimeout, err := durationEnv("MODEL_CALL_TIMEOUT", 60*time.Second)
+	if err != nil {
+		log.Fatal(err)
+	}
+	openDuration, err := durationEnv("BREAKER_OPEN_DURATION", 30*time.Second)
+	if err != nil {
+		log.Fatal(err)
+	}
+	failureThreshold := 5
+	if value := os.Getenv("BREAKER_FAILURE_THRESHOLD"); value != "" {
+		failureThreshold, err = strconv.Atoi(value)
+		if err != nil || failureThreshold < 1 {
+			log.Fatalf("BREAKER_FAILURE_THRESHOLD must be a positive number, got %q", value)
+		}
+	}
+	breaker := handlers.NewCircuitBreaker(storyteller.Name(), failureThreshold, openDuration)
+
+	recipes, err := newCookbook()
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer client.Close()
 
 	sessionManager := session.NewManager()
 
 	h := &handlers.Handler{
-		Client:  client,
-		Manager: sessionManager,
+		Storyteller: storyteller,
+		Manager:     sessionManager,
+		Budget:      budget,
+		Breaker:     breaker,
+		CallTimeout: callTimeout,
+		Recipes:     recipes,
 	}
 
 	mux := http.NewServeMux()
@@ -56,14 +91,22 @@ func main() {
 
 	// Health check endpoints
 	mux.HandleFunc("/health", handlers.HealthCheckHandler)
-	mux.HandleFunc("/ready", handlers.ReadinessHandler)
+	mux.HandleFunc("/ready", handlers.NewReadinessHandler(breaker))
 
 	// Metrics endpoint
 	mux.HandleFunc("/metrics", metrics.GetMetricsEndpoint())
 
+	mux.HandleFunc("/character", h.CreateCharacter)
 	mux.HandleFunc("/start", h.StartStory)
 	mux.HandleFunc("/generate", h.Generate)
+	mux.HandleFunc("/stream", h.Stream)
 	mux.HandleFunc("/download", h.DownloadStory)
+	mux.HandleFunc("/journal/objectives", h.ToggleObjectives)
+	mux.HandleFunc("/rewind", h.Rewind)
+	mux.HandleFunc("/fork", h.Fork)
+	mux.HandleFunc("/branches", h.Branches)
+	mux.HandleFunc("/branches/switch", h.SwitchBranch)
+	mux.HandleFunc("/branches/compare", h.CompareBranches)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -73,3 +116,124 @@ func main() {
 	log.Println("Listening on http://0.0.0.0:" + port)
 	log.Fatal(http.ListenAndServe(":"+port, mux))
 }
+
+// newStoryteller builds the story backend, optionally recording to or replaying from
+// a cassette selected by CASSETTE_MODE and CASSETTE_PATH.
+// The returned function releases any resources held by the backend.
+func newStoryteller(ctx context.Context) (handlers.Storyteller, func(), error) {
+	cassettePath := os.Getenv("CASSETTE_PATH")
+	if cassettePath == "" {
+		cassettePath = "cassette.jsonl"
+	}
+
+	switch mode := os.Getenv("CASSETTE_MODE"); mode {
+	case "":
+		return newProvider(ctx)
+	case "replay":
+		replay, err := handlers.NewReplayStoryteller(cassettePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Printf("Replaying model responses from %s", cassettePath)
+		return replay, func() {}, nil
+	case "record":
+		provider, closeProvider, err := newProvider(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		recorder, err := handlers.NewRecordingStoryteller(provider, cassettePath)
+		if err != nil {
+			closeProvider()
+			return nil, nil, err
+		}
+		log.Printf("Recording model exchanges to %s", cassettePath)
+		return recorder.Streaming(), func() { recorder.Close(); closeProvider() }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown CASSETTE_MODE %q", mode)
+	}
+}
+
+// newProvider builds the model backend selected by the STORYTELLER environment variable.
+func newProvider(ctx context.Context) (handlers.Storyteller, func(), error) {
+	provider := os.Getenv("STORYTELLER")
+	if provider == "" {
+		provider = "gemini"
+	}
+
+	switch provider {
+	case "gemini":
+		apiKey := os.Getenv("GEMINI_API_KEY")
+		if apiKey == "" {
+			return nil, nil, fmt.Errorf("GEMINI_API_KEY must be set (or use STORYTELLER=mock for offline development)")
+		}
+		client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Printf("Using Gemini storyteller")
+		return handlers.NewGeminiStoryteller(client, os.Getenv("GEMINI_MODEL")), func() { client.Close() }, nil
+	case "openai":
+		model := os.Getenv("OPENAI_MODEL")
+		if model == "" {
+			return nil, nil, fmt.Errorf("OPENAI_MODEL must be set when STORYTELLER=openai")
+		}
+		log.Printf("Using OpenAI-compatible storyteller (model %s)", model)
+		return handlers.NewOpenAIStoryteller(os.Getenv("OPENAI_BASE_URL"), os.Getenv("OPENAI_API_KEY"), model), func() {}, nil
+	case "mock":
+		log.Printf("Using offline mock storyteller")
+		return handlers.NewMockStoryteller(), func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown STORYTELLER %q", provider)
+	}
+}
+
+// newTokenBudget builds the daily token budgets from TOKEN_BUDGET_SESSION, TOKEN_BUDGET_IP
+// and TOKEN_BUDGET_GLOBAL, persisted at TOKEN_BUDGET_PATH. It returns nil when no limit is set.
+func newTokenBudget() (*handlers.TokenBudget, error) {
+	limits := make([]int, 3)
+	for i, name := range []string{"TOKEN_BUDGET_SESSION", "TOKEN_BUDGET_IP", "TOKEN_BUDGET_GLOBAL"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("%s must be a non-negative number of tokens, got %q", name, value)
+		}
+		limits[i] = limit
+	}
+	if limits[0] == 0 && limits[1] == 0 && limits[2] == 0 {
+		return nil, nil
+	}
+
+	path := os.Getenv("TOKEN_BUDGET_PATH")
+	if path == "" {
+		path = "token_budget.json"
+	}
+	log.Printf("Daily token budgets: session=%d ip=%d global=%d (0 = unlimited), saved to %s", limits[0], limits[1], limits[2], path)
+	return handlers.NewTokenBudget(path, limits[0], limits[1], limits[2])
+}
+
+// newCookbook loads the crafting recipes from the genre files in RECIPES_DIR, or uses
+// the built-in recipes when it is not set.
+func newCookbook() (*story.Cookbook, error) {
+	dir := os.Getenv("RECIPES_DIR")
+	if dir == "" {
+		return story.DefaultCookbook(), nil
+	}
+	log.Printf("Loading crafting recipes from %s", dir)
+	return story.LoadCookbook(os.DirFS(dir))
+}
+
+// durationEnv parses a duration such as "45s" from the named environment variable.
+func durationEnv(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s must be a duration such as 45s, got %q", name, value)
+	}
+	return d, nil
+}
@@ -239,6 +239,184 @@ func RecordAPIUsage(provider string, tokens int, duration time.Duration, success
 	}
 }
 
+// RecordTokenUsage records tokens consumed by AI calls, broken down by story settings
+func RecordTokenUsage(provider string, genre string, persona string, difficulty string, promptTokens int, candidateTokens int, totalTokens int) {
+	if defaultCollector == nil {
+		return
+	}
+
+	if persona == "" {
+		persona = "classic"
+	}
+	labels := map[string]string{
+		"provider":   provider,
+		"genre":      genre,
+		"persona":    persona,
+		"difficulty": difficulty,
+	}
+
+	defaultCollector.RecordCounter("ai_prompt_tokens_total", float64(promptTokens), labels, "Total number of prompt tokens sent to the AI")
+	defaultCollector.RecordCounter("ai_candidate_tokens_total", float64(candidateTokens), labels, "Total number of tokens generated by the AI")
+	defaultCollector.RecordCounter("ai_tokens_total", float64(totalTokens), labels, "Total number of tokens used by the AI")
+}
+
+// RecordAIRetry records a transient AI failure that is being retried
+func RecordAIRetry(provider string, errorType string) {
+	if defaultCollector == nil {
+		return
+	}
+
+	labels := map[string]string{
+		"provider":   provider,
+		"error_type": errorType,
+	}
+
+	defaultCollector.RecordCounter("ai_retries_total", 1, labels, "Total number of AI calls retried after a transient failure")
+}
+
+// SetCircuitBreakerState records the AI circuit breaker's state (0 closed, 1 half-open, 2 open)
+func SetCircuitBreakerState(provider string, state string) {
+	if defaultCollector == nil {
+		return
+	}
+
+	value := 0.0
+	switch state {
+	case "half_open":
+		value = 1
+	case "open":
+		value = 2
+	}
+	labels := map[string]string{
+		"provider": provider,
+	}
+
+	defaultCollector.SetGauge("ai_circuit_breaker_state", value, labels, "AI circuit breaker state: 0 closed, 1 half-open, 2 open")
+	defaultCollector.RecordCounter("ai_circuit_breaker_transitions_total", 1, map[string]string{"provider": provider, "state": state}, "Total number of AI circuit breaker state changes")
+}
+
+// RecordHTMLSanitized records markup removed from AI story text by the sanitizer
+func RecordHTMLSanitized(kind string, element string) {
+	if defaultCollector == nil {
+		return
+	}
+
+	labels := map[string]string{
+		"kind":    kind,
+		"element": element,
+	}
+
+	defaultCollector.RecordCounter("story_html_violations_total", 1, labels, "Total number of disallowed markup items removed from story text")
+}
+
+// RecordPromptInjection records a suspected prompt-injection attempt and how it was handled
+func RecordPromptInjection(outcome string) {
+	if defaultCollector == nil {
+		return
+	}
+
+	labels := map[string]string{
+		"outcome": outcome,
+	}
+
+	defaultCollector.RecordCounter("prompt_injection_total", 1, labels, "Total number of suspected prompt-injection turns")
+}
+
+// RecordInventoryMismatch records a turn whose inventory change disagrees with the items the model reported
+func RecordInventoryMismatch(provider string) {
+	if defaultCollector == nil {
+		return
+	}
+
+	labels := map[string]string{
+		"provider": provider,
+	}
+
+	defaultCollector.RecordCounter("inventory_mismatch_total", 1, labels, "Total number of inventory changes that disagree with the model's reported items")
+}
+
+// RecordStateCorrection records a game-state invariant the model broke and whether it was repaired or re-asked
+func RecordStateCorrection(invariant string, action string) {
+	if defaultCollector == nil {
+		return
+	}
+
+	labels := map[string]string{
+		"invariant": invariant,
+		"action":    action,
+	}
+
+	defaultCollector.RecordCounter("state_corrections_total", 1, labels, "Total number of game-state invariant corrections")
+}
+
+// RecordRewind records a story rewound to an earlier turn
+func RecordRewind(difficulty string) {
+	if defaultCollector == nil {
+		return
+	}
+
+	labels := map[string]string{
+		"difficulty": difficulty,
+	}
+
+	defaultCollector.RecordCounter("story_rewinds_total", 1, labels, "Total number of stories rewound to an earlier turn")
+}
+
+// RecordFork records a story forked into a new branch
+func RecordFork(difficulty string) {
+	if defaultCollector == nil {
+		return
+	}
+
+	labels := map[string]string{
+		"difficulty": difficulty,
+	}
+
+	defaultCollector.RecordCounter("story_forks_total", 1, labels, "Total number of stories forked into a new branch")
+}
+
+// RecordSkillCheck records a skill check rolled for a risky action
+func RecordSkillCheck(skill, difficulty, verdict string) {
+	if defaultCollector == nil {
+		return
+	}
+
+	labels := map[string]string{
+		"skill":      skill,
+		"difficulty": difficulty,
+		"verdict":    verdict,
+	}
+
+	defaultCollector.RecordCounter("skill_checks_total", 1, labels, "Total number of skill checks rolled, by verdict")
+}
+
+// RecordCraft records a combine action, resolved by a recipe or left to the model
+func RecordCraft(genre, outcome string) {
+	if defaultCollector == nil {
+		return
+	}
+
+	labels := map[string]string{
+		"genre":   genre,
+		"outcome": outcome,
+	}
+
+	defaultCollector.RecordCounter("crafts_total", 1, labels, "Total number of combine actions, by how they were resolved")
+}
+
+// RecordBudgetExhausted records a request refused because a daily token budget was used up
+func RecordBudgetExhausted(scope string) {
+	if defaultCollector == nil {
+		return
+	}
+
+	labels := map[string]string{
+		"scope": scope,
+	}
+
+	defaultCollector.RecordCounter("token_budget_exhausted_total", 1, labels, "Total number of requests refused by a token budget")
+}
+
 // RecordUserActivity records user activity metrics
 func RecordUserActivity(action string, genre string, sessionDuration time.Duration) {
 	if defaultCollector == nil {
@@ -267,6 +445,20 @@ func RecordError(errorType string, message string) {
 	defaultCollector.RecordCounter("application_errors_total", 1, labels, "Total number of application errors")
 }
 
+// RecordJSONRepair records a local repair strategy applied to malformed AI JSON
+func RecordJSONRepair(strategy string, success bool) {
+	if defaultCollector == nil {
+		return
+	}
+
+	labels := map[string]string{
+		"strategy": strategy,
+		"success":  strconv.FormatBool(success),
+	}
+
+	defaultCollector.RecordCounter("ai_json_repair_total", 1, labels, "Total number of local JSON repairs applied to AI responses")
+}
+
 // RecordRateLimit records rate limiting events
 func RecordRateLimit(identifier string, blocked bool) {
 	if defaultCollector == nil {
@@ -113,6 +113,11 @@ func RateLimitMiddleware(rl *RateLimiter) func(http.Handler) http.Handler {
 	}
 }
 
+// ClientIP returns the client IP address for the request, resolved the same way as for rate limiting.
+func ClientIP(r *http.Request) string {
+	return getClientIP(r)
+}
+
 // getClientIP extracts the client IP address from the request
 func getClientIP(r *http.Request) string {
 	// Check X-Forwarded-For header first (for proxies)
@@ -1,9 +1,12 @@
 package session
 
 import (
+	"cmp"
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
 	"net/http"
+	"slices"
 	"story_ai/story"
 	"sync"
 	"time"
@@ -23,6 +26,22 @@ type Session struct {
 	HistoricalURL     string
 	HistoricalSummary string
 	CSRFToken         string
+	PendingAction     string // Player action waiting to be streamed by /stream
+	PromptTokens      int
+	CandidateTokens   int
+	TotalTokens       int
+	KnownRooms        map[string]story.Environment // Rooms seen this story, so the offline engine can return to them
+	WorldMap          *story.WorldMap              // Locations visited this story and the exits between them
+	Journal           *story.Journal               // Puzzles solved and clues found this story
+	ShowObjectives    bool                         // Reveal the win conditions in the journal (exploratory only)
+	Rewinds           int                          // Times this story has been rewound to an earlier turn
+	ParentID          string                       // The session this one was forked from, if any
+	ForkTurn          int                          // The parent's turn this session was forked at
+	BudgetKey         string                       // The session whose token budget this one spends, if not its own
+	DiceSeed          uint64                       // Seeds the story's skill check rolls
+	TurnCheck         *story.Check                 // The skill check rolled for the turn in progress, if any
+	TurnCraft         *story.Craft                 // The recipe the turn in progress crafts with, if any
+	CreatedAt         time.Time
 }
 
 // Manager handles the creation, storage, and retrieval of sessions.
@@ -43,20 +62,123 @@ func (m *Manager) CreateSession() string {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	// Generate a random, secure session ID.
-	b := make([]byte, 16)
-	rand.Read(b)
-	id := hex.EncodeToString(b)
-
+	id := newSessionID()
 	m.sessions[id] = &Session{
 		ID:           id,
 		GameState:    &story.GameState{},
 		StoryHistory: []story.StoryPage{},
 		LastAccessed: time.Now(),
+		CreatedAt:    time.Now(),
 	}
 	return id
 }
 
+// newSessionID generates a random, secure session ID.
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Fork copies a session as it was after the given turn into a new session whose
+// ParentID points back to it. Tokens start from zero; the rooms, map and journal are
+// left for the caller to rebuild from the copied pages.
+func (m *Manager) Fork(id string, turn int) (*Session, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	parent, ok := m.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("session %s not found", id)
+	}
+	if turn < 0 || turn >= len(parent.StoryHistory) || parent.StoryHistory[turn].State == nil {
+		return nil, fmt.Errorf("turn %d of session %s cannot be forked", turn, id)
+	}
+
+	fork := &Session{
+		ID:                newSessionID(),
+		GameState:         parent.StoryHistory[turn].State.Clone(),
+		StoryHistory:      clonePages(parent.StoryHistory[:turn+1]),
+		CurrentGenre:      parent.CurrentGenre,
+		CurrentAuthor:     parent.CurrentAuthor,
+		NarratorPersona:   parent.NarratorPersona,
+		LastAccessed:      time.Now(),
+		HistoricalEvent:   parent.HistoricalEvent,
+		HistoricalDesc:    parent.HistoricalDesc,
+		HistoricalURL:     parent.HistoricalURL,
+		HistoricalSummary: parent.HistoricalSummary,
+		ShowObjectives:    parent.ShowObjectives,
+		Rewinds:           parent.Rewinds,
+		ParentID:          parent.ID,
+		ForkTurn:          turn,
+		BudgetKey:         parent.BudgetID(),
+		DiceSeed:          parent.DiceSeed,
+		CreatedAt:         time.Now(),
+	}
+	m.sessions[fork.ID] = fork
+	return fork, nil
+}
+
+// BudgetID returns the key the session's token spending is charged to. Forks spend
+// from the budget of the story they were forked from, so forking does not reset it.
+func (s *Session) BudgetID() string {
+	if s.BudgetKey != "" {
+		return s.BudgetKey
+	}
+	return s.ID
+}
+
+// clonePages copies story pages so a fork shares nothing with the story it came from.
+func clonePages(pages []story.StoryPage) []story.StoryPage {
+	clone := make([]story.StoryPage, len(pages))
+	for i, page := range pages {
+		clone[i] = page.Clone()
+	}
+	return clone
+}
+
+// Branches returns every session in the same fork tree as the given one, oldest first.
+func (m *Manager) Branches(id string) []*Session {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	root := m.rootOf(id)
+	if root == "" {
+		return nil
+	}
+	var branches []*Session
+	for _, s := range m.sessions {
+		if m.rootOf(s.ID) == root {
+			branches = append(branches, s)
+		}
+	}
+	slices.SortFunc(branches, func(a, b *Session) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return branches
+}
+
+// rootOf follows parent pointers to the session a fork tree started from. The caller
+// must hold the mutex.
+func (m *Manager) rootOf(id string) string {
+	s, ok := m.sessions[id]
+	if !ok {
+		return ""
+	}
+	for seen := map[string]bool{}; s.ParentID != "" && !seen[s.ID]; {
+		seen[s.ID] = true
+		parent, ok := m.sessions[s.ParentID]
+		if !ok {
+			break
+		}
+		s = parent
+	}
+	return s.ID
+}
+
 // GetSession retrieves a session by its ID.
 func (m *Manager) GetSession(id string) *Session {
 	m.mutex.Lock()
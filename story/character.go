@@ -0,0 +1,103 @@
+package story
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Character is the player character created before the first turn.
+type Character struct {
+	Name   string   `json:"name"`
+	Role   string   `json:"role"`
+	Traits []string `json:"traits,omitempty"`
+}
+
+// CharacterOptions are the roles and traits a genre offers at character creation.
+type CharacterOptions struct {
+	Roles  []string
+	Traits []string
+}
+
+// Limits on a new character.
+const (
+	MinTraits     = 2
+	MaxTraits     = 3
+	MaxNameLength = 30
+)
+
+var characterOptions = map[string]CharacterOptions{
+	"fantasy": {
+		Roles:  []string{"Knight", "Ranger", "Apprentice Mage", "Thief", "Healer", "Bard", "Blacksmith"},
+		Traits: []string{"brave", "nimble", "strong", "clever", "silver-tongued", "stealthy", "devout", "keen-eyed", "stubborn", "curious"},
+	},
+	"sci-fi": {
+		Roles:  []string{"Pilot", "Engineer", "Medic", "Marine", "Hacker", "Smuggler", "Xenobiologist"},
+		Traits: []string{"tech-savvy", "quick reflexes", "strong", "calm under pressure", "silver-tongued", "stealthy", "analytical", "resilient", "curious", "keen-eyed"},
+	},
+	"historical-fiction": {
+		Roles:  []string{"Soldier", "Merchant", "Scholar", "Physician", "Sailor", "Farmer", "Cleric", "Journalist"},
+		Traits: []string{"brave", "literate", "strong", "well-connected", "silver-tongued", "devout", "shrewd", "resilient", "observant", "stubborn"},
+	},
+}
+
+// characterName allows letters, spaces, apostrophes, hyphens and full stops, so a name
+// cannot carry instructions for the model.
+var characterName = regexp.MustCompile(`^\p{L}[\p{L}\p{M}' .-]*$`)
+
+// OptionsFor returns the roles and traits offered for a genre. Unknown genres get the
+// fantasy options, as StartStory defaults to fantasy.
+func OptionsFor(genre string) CharacterOptions {
+	if options, ok := characterOptions[genre]; ok {
+		return options
+	}
+	return characterOptions["fantasy"]
+}
+
+// NewCharacter validates a character against the genre's options. The role and traits
+// must come from OptionsFor; the name is trimmed and its spaces collapsed.
+func NewCharacter(genre, name, role string, traits []string) (*Character, error) {
+	options := OptionsFor(genre)
+	name = strings.Join(strings.Fields(name), " ")
+	switch {
+	case name == "":
+		return nil, fmt.Errorf("character name cannot be empty")
+	case utf8.RuneCountInString(name) > MaxNameLength:
+		return nil, fmt.Errorf("character name must be %d characters or less", MaxNameLength)
+	case !characterName.MatchString(name):
+		return nil, fmt.Errorf("character name may only contain letters, spaces, apostrophes, hyphens and full stops")
+	case !slices.Contains(options.Roles, role):
+		return nil, fmt.Errorf("choose a role from the list")
+	case len(traits) < MinTraits || len(traits) > MaxTraits:
+		return nil, fmt.Errorf("choose %d or %d traits", MinTraits, MaxTraits)
+	}
+	for i, trait := range traits {
+		if !slices.Contains(options.Traits, trait) {
+			return nil, fmt.Errorf("choose traits from the list")
+		}
+		if slices.Contains(traits[:i], trait) {
+			return nil, fmt.Errorf("each trait may only be chosen once")
+		}
+	}
+	return &Character{Name: name, Role: role, Traits: slices.Clone(traits)}, nil
+}
+
+// Equal reports whether two characters are the same.
+func (c *Character) Equal(other *Character) bool {
+	if c == nil || other == nil {
+		return c == other
+	}
+	return c.Name == other.Name && c.Role == other.Role && slices.Equal(c.Traits, other.Traits)
+}
+
+// Clone returns a copy of the character that can be changed independently.
+func (c *Character) Clone() *Character {
+	if c == nil {
+		return nil
+	}
+	clone := *c
+	clone.Traits = slices.Clone(c.Traits)
+	return &clone
+}
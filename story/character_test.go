@@ -0,0 +1,21 @@
+package story
+
+import "testing"
+
+func TestEnforceKeepsCharacter(t *testing.T) {
+	c, err := NewCharacter("sci-fi", "Ada Vance", "Pilot", []string{"strong", "curious"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := testState()
+	before.Character = c
+	after := before.Clone()
+	after.Character = nil
+	if e := Enforce(before, after, false, nil); len(e.Corrections) != 0 || !after.Character.Equal(c) {
+		t.Errorf("an omitted character should be restored silently: %+v %+v", e, after.Character)
+	}
+	after.Character = &Character{Name: "Zed", Role: "Marine"}
+	if e := Enforce(before, after, false, nil); len(e.Corrections) != 1 || after.Character.Name != "Ada Vance" {
+		t.Errorf("a rewritten character should be corrected: %+v %+v", e, after.Character)
+	}
+}
@@ -0,0 +1,196 @@
+package story
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Recipe makes a new item from ingredients with the given properties. Each input is one
+// ingredient, matched by any of its "|"-separated properties, e.g. "stick|wooden".
+type Recipe struct {
+	Inputs []string `json:"inputs"`
+	Keep   []string `json:"keep,omitempty"` // Inputs that are tools and are not used up
+	Result Item     `json:"result"`
+}
+
+// Craft is a combine action resolved by a recipe, for the model to narrate.
+type Craft struct {
+	Result   Item     `json:"result"`
+	Consumed []string `json:"consumed"`            // Ingredients used up
+	FromRoom []string `json:"from_room,omitempty"` // Consumed ingredients taken from the room, not the inventory
+	Tools    []string `json:"tools,omitempty"`     // Ingredients kept
+}
+
+// Cookbook holds the crafting recipes for each genre. Recipes in the "common" genre
+// apply to every story.
+type Cookbook struct {
+	genres map[string][]Recipe
+}
+
+// commonRecipes is the genre whose recipes every genre shares.
+const commonRecipes = "common"
+
+//go:embed recipes/*.json
+var defaultRecipes embed.FS
+
+// DefaultCookbook returns the recipes built into the game.
+func DefaultCookbook() *Cookbook {
+	sub, _ := fs.Sub(defaultRecipes, "recipes")
+	book, err := LoadCookbook(sub)
+	if err != nil {
+		panic(err)
+	}
+	return book
+}
+
+// LoadCookbook reads one JSON file of recipes per genre, named after the genre, e.g.
+// "sci-fi.json", and "common.json" for recipes shared by every genre.
+func LoadCookbook(fsys fs.FS) (*Cookbook, error) {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	book := &Cookbook{genres: make(map[string][]Recipe)}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recipes: %w", err)
+		}
+		var recipes []Recipe
+		if err := json.Unmarshal(data, &recipes); err != nil {
+			return nil, fmt.Errorf("invalid recipes file %s: %w", file, err)
+		}
+		for i, r := range recipes {
+			if len(r.Inputs) < 2 || r.Result.Name == "" {
+				return nil, fmt.Errorf("invalid recipes file %s: recipe %d needs two inputs and a result", file, i)
+			}
+		}
+		genre := strings.TrimSuffix(path.Base(file), ".json")
+		book.genres[genre] = recipes
+	}
+	return book, nil
+}
+
+// For returns the recipes for a genre, its own before the common ones.
+func (b *Cookbook) For(genre string) []Recipe {
+	if b == nil {
+		return nil
+	}
+	return slices.Concat(b.genres[genre], b.genres[commonRecipes])
+}
+
+// combineAction matches actions that try to make something from several things.
+var combineAction = regexp.MustCompile(`(?i)\b(combine|craft|make|build|tie|attach|wrap|mix|assemble|fashion|bind|lash|brew|forge)\b`)
+
+// IsCombineAction reports whether an action tries to make something from several things.
+func IsCombineAction(action string) bool {
+	return combineAction.MatchString(action)
+}
+
+// ingredient is something the player named in a combine action.
+type ingredient struct {
+	name       string
+	properties []string
+	inRoom     bool // A world object rather than an inventory item
+}
+
+// Resolve finds the recipe for a combine action, using the inventory items and room
+// objects the action names. The first recipe, in the genre's order, whose every input
+// is matched by a different named ingredient wins. It returns nil when the action does
+// not combine things or no recipe fits, which leaves the outcome to the model.
+func (b *Cookbook) Resolve(state *GameState, genre, action string) *Craft {
+	if b == nil || state == nil || !IsCombineAction(action) {
+		return nil
+	}
+	var named []ingredient
+	for _, item := range state.Inventory {
+		if namesItem(action, item.Name) {
+			named = append(named, ingredient{item.Name, item.Properties, false})
+		}
+	}
+	for _, obj := range state.Environment.WorldObjects {
+		if namesItem(action, obj.Name) {
+			named = append(named, ingredient{obj.Name, obj.Properties, true})
+		}
+	}
+	if len(named) < 2 {
+		return nil
+	}
+
+	for _, recipe := range b.For(genre) {
+		match := matchInputs(recipe.Inputs, named, make([]int, 0, len(recipe.Inputs)))
+		if match == nil {
+			continue
+		}
+		craft := &Craft{Result: recipe.Result}
+		craft.Result.Properties = slices.Clone(recipe.Result.Properties)
+		for i, input := range recipe.Inputs {
+			ing := named[match[i]]
+			switch {
+			case slices.Contains(recipe.Keep, input):
+				craft.Tools = append(craft.Tools, ing.name)
+			case ing.inRoom:
+				craft.Consumed = append(craft.Consumed, ing.name)
+				craft.FromRoom = append(craft.FromRoom, ing.name)
+			default:
+				craft.Consumed = append(craft.Consumed, ing.name)
+			}
+		}
+		return craft
+	}
+	return nil
+}
+
+// matchInputs assigns a different ingredient to each remaining input, trying them in
+// order, and returns the ingredient indices or nil if the inputs cannot all be matched.
+func matchInputs(inputs []string, named []ingredient, used []int) []int {
+	if len(used) == len(inputs) {
+		return used
+	}
+	alternatives := strings.Split(inputs[len(used)], "|")
+	for i, ing := range named {
+		if slices.Contains(used, i) || !slices.ContainsFunc(ing.properties, func(p string) bool { return containsWord(alternatives, p) }) {
+			continue
+		}
+		if match := matchInputs(inputs, named, append(used, i)); match != nil {
+			return match
+		}
+	}
+	return nil
+}
+
+// Apply makes the crafted result part of after, whatever the model wrote: each consumed
+// ingredient leaves the inventory or the room, wherever Resolve found it, and the result
+// joins the inventory. It returns the names it added and removed from the inventory.
+func (c *Craft) Apply(after *GameState) (added, removed []string) {
+	if c == nil || after == nil {
+		return nil, nil
+	}
+	fromRoom := slices.Clone(c.FromRoom)
+	for _, name := range c.Consumed {
+		if i := slices.IndexFunc(fromRoom, func(obj string) bool { return strings.EqualFold(obj, name) }); i >= 0 {
+			fromRoom = slices.Delete(fromRoom, i, i+1)
+			if j := slices.IndexFunc(after.Environment.WorldObjects, func(obj WorldObject) bool { return strings.EqualFold(obj.Name, name) }); j >= 0 {
+				after.Environment.WorldObjects = slices.Delete(after.Environment.WorldObjects, j, j+1)
+			}
+			continue
+		}
+		if i := slices.IndexFunc(after.Inventory, func(item Item) bool { return strings.EqualFold(item.Name, name) }); i >= 0 {
+			after.Inventory = slices.Delete(after.Inventory, i, i+1)
+			removed = append(removed, name)
+		}
+	}
+	if !slices.ContainsFunc(after.Inventory, func(item Item) bool { return strings.EqualFold(item.Name, c.Result.Name) }) {
+		result := c.Result
+		result.Properties = slices.Clone(c.Result.Properties)
+		after.Inventory = append(after.Inventory, result)
+		added = append(added, result.Name)
+	}
+	return added, removed
+}
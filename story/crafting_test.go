@@ -0,0 +1,76 @@
+package story
+
+import (
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCookbookResolvesCombinations(t *testing.T) {
+	book := DefaultCookbook()
+	state := testState()
+	state.Inventory = append(state.Inventory,
+		Item{Name: "lamp oil", Properties: []string{"flammable", "liquid"}},
+		Item{Name: "broom handle", Properties: []string{"wooden"}},
+		Item{Name: "wild sage", Properties: []string{"herb"}},
+	)
+
+	craft := book.Resolve(state, "fantasy", "make a torch from the lamp oil, curtains and broom handle")
+	if craft == nil || craft.Result.Name != "torch" || !slices.Equal(craft.Consumed, []string{"lamp oil", "old curtains", "broom handle"}) {
+		t.Fatalf("expected a torch: %+v", craft)
+	}
+	if !slices.Equal(craft.FromRoom, []string{"old curtains"}) {
+		t.Errorf("only the curtains come from the room: %+v", craft.FromRoom)
+	}
+	// The genre's own recipes come before the common ones.
+	if craft := book.Resolve(state, "fantasy", "mix the sage with the lamp oil"); craft == nil || craft.Result.Name != "healing draught" {
+		t.Errorf("expected a healing draught: %+v", craft)
+	}
+	if craft := book.Resolve(state, "sci-fi", "mix the sage with the lamp oil"); craft != nil {
+		t.Errorf("sci-fi has no herbal recipe, so the model decides: %+v", craft)
+	}
+	if craft := book.Resolve(state, "fantasy", "look at the lamp oil and the broom handle"); craft != nil {
+		t.Errorf("only combine actions craft: %+v", craft)
+	}
+
+	if _, err := LoadCookbook(fstest.MapFS{"fantasy.json": {Data: []byte(`[{"inputs":["cloth"],"result":{"name":"rag"}}]`)}}); err == nil {
+		t.Error("a one-ingredient recipe should be rejected")
+	}
+	custom, err := LoadCookbook(fstest.MapFS{"sci-fi.json": {Data: []byte(`[{"inputs":["herb","flammable"],"keep":["flammable"],"result":{"name":"smoke bundle","props":["smoke"]}}]`)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if craft := custom.Resolve(state, "sci-fi", "tie the sage to the lamp oil"); craft == nil || !slices.Equal(craft.Tools, []string{"lamp oil"}) || !slices.Equal(craft.Consumed, []string{"wild sage"}) {
+		t.Errorf("expected the oil to be kept as a tool: %+v", craft)
+	}
+}
+
+func TestCraftRemovesIngredientsFromTheirSource(t *testing.T) {
+	book, err := LoadCookbook(fstest.MapFS{"fantasy.json": {Data: []byte(`[{"inputs":["rope","hook"],"result":{"name":"grappling line"}}]`)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := testState()
+	state.Inventory = append(state.Inventory, Item{Name: "rope", Properties: []string{"rope"}}, Item{Name: "hook", Properties: []string{"hook"}})
+	state.Environment.WorldObjects = append(state.Environment.WorldObjects, WorldObject{Name: "rope", Properties: []string{"rope"}})
+
+	craft := book.Resolve(state, "fantasy", "tie the rope to the hook")
+	if craft == nil || len(craft.FromRoom) != 0 {
+		t.Fatalf("expected the carried rope to be used: %+v", craft)
+	}
+	after := state.Clone()
+	added, removed := craft.Apply(after)
+	if !slices.Equal(added, []string{"grappling line"}) || !slices.Equal(removed, []string{"rope", "hook"}) {
+		t.Errorf("unexpected changes: added %v, removed %v", added, removed)
+	}
+	if objs := after.Environment.WorldObjects; objs[len(objs)-1].Name != "rope" {
+		t.Errorf("the rope in the room should be left alone: %+v", objs)
+	}
+
+	// Names are matched without regard to case, in the room as in the inventory.
+	craft = &Craft{Result: Item{Name: "grappling line"}, Consumed: []string{"Rope", "Hook"}, FromRoom: []string{"rope"}}
+	after = state.Clone()
+	if _, removed := craft.Apply(after); !slices.Equal(removed, []string{"Hook"}) || len(after.Environment.WorldObjects) != 2 {
+		t.Errorf("expected the room's rope and the carried hook to be used: removed %v, room %+v", removed, after.Environment.WorldObjects)
+	}
+}
@@ -0,0 +1,158 @@
+package story
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Verdict is the outcome of a skill check, which the model must narrate.
+type Verdict string
+
+const (
+	VerdictSuccess Verdict = "success"
+	VerdictPartial Verdict = "partial"
+	VerdictFailure Verdict = "failure"
+)
+
+// Check is a server-rolled skill check for a risky action.
+type Check struct {
+	Skill     string   `json:"skill"`
+	Roll      int      `json:"roll"` // The natural d20 roll
+	Modifier  int      `json:"mod"`
+	Target    int      `json:"target"`
+	Verdict   Verdict  `json:"verdict"`
+	Modifiers []string `json:"why,omitempty"` // What made up the modifier, e.g. "rope +2"
+}
+
+// Clone returns a copy of the check that can be changed independently.
+func (c *Check) Clone() *Check {
+	if c == nil {
+		return nil
+	}
+	clone := *c
+	clone.Modifiers = slices.Clone(c.Modifiers)
+	return &clone
+}
+
+// Total is the roll plus its modifier.
+func (c *Check) Total() int {
+	return c.Roll + c.Modifier
+}
+
+// String describes the check in one line, e.g. "athletics 14+2 vs 11: success".
+func (c *Check) String() string {
+	return fmt.Sprintf("%s %d%+d vs %d: %s", c.Skill, c.Roll, c.Modifier, c.Target, c.Verdict)
+}
+
+// riskySkill maps risky actions to the skill they test.
+type riskySkill struct {
+	skill    string
+	pattern  *regexp.Regexp
+	physical bool     // Tested by the body, so weakened by low stamina and heavy loads
+	helpers  []string // Item properties that help
+}
+
+var riskySkills = []riskySkill{
+	{"combat", regexp.MustCompile(`(?i)\b(attack|fight|stab|strike|shoot|punch|kick|slash|hit|duel)\b`), true, []string{"weapon", "sharp", "blade", "ranged"}},
+	{"athletics", regexp.MustCompile(`(?i)\b(climb|jump|leap|swim|vault|scale)\b`), true, []string{"rope", "climbing", "grappling"}},
+	{"strength", regexp.MustCompile(`(?i)\b(force|break|smash|bash|pry|shove|lift)\b`), true, []string{"lever", "prying", "blunt"}},
+	{"stealth", regexp.MustCompile(`(?i)\b(sneak|hide|creep|steal|pickpocket|tiptoe)\b`), true, []string{"quiet", "cloak", "disguise", "shadow"}},
+	{"agility", regexp.MustCompile(`(?i)\b(dodge|flee|escape|duck|evade|outrun)\b`), true, []string{"nimble", "swift"}},
+	{"persuasion", regexp.MustCompile(`(?i)\b(persuade|convince|bribe|bluff|intimidate|threaten|deceive|charm|negotiate|lie to)\b`), false, []string{"valuable", "gold", "gift", "badge", "authority"}},
+}
+
+// checkTargets is the roll needed to succeed on each difficulty.
+var checkTargets = map[string]int{
+	"exploratory": 8,
+	"challenging": 11,
+	"punishing":   14,
+}
+
+// Conditions that make checks harder or easier.
+var (
+	hinderingConditions = []string{"wounded", "injured", "bleeding", "poisoned", "exhausted", "tired", "blinded", "stunned", "frightened", "sick", "weak", "drunk", "broken"}
+	helpingConditions   = []string{"blessed", "inspired", "rested", "focused", "hidden", "hasted"}
+)
+
+// partialMargin is how far short of the target a roll can fall and still partly succeed.
+const partialMargin = 4
+
+// Resolve classifies an action and, if it is risky, rolls a skill check for it. The
+// roll is seeded by the story's seed, the turn and the skill, not the action's wording,
+// so replaying or rewording a turn after a rewind gives the same result. It returns nil
+// for actions that need no check.
+func Resolve(state *GameState, action string, seed uint64, turn int) *Check {
+	if state == nil {
+		return nil
+	}
+	i := slices.IndexFunc(riskySkills, func(s riskySkill) bool { return s.pattern.MatchString(action) })
+	if i < 0 {
+		return nil
+	}
+	skill := riskySkills[i]
+
+	c := &Check{Skill: skill.skill, Target: 11}
+	if target, ok := checkTargets[state.Rules.ConsequenceModel]; ok {
+		c.Target = target
+	}
+	modify := func(n int, why string) {
+		c.Modifier += n
+		c.Modifiers = append(c.Modifiers, fmt.Sprintf("%s %+d", why, n))
+	}
+
+	for _, cond := range state.PlayerStatus.Conditions {
+		switch {
+		case containsWord(hinderingConditions, cond.Name):
+			modify(-2, cond.Name)
+		case containsWord(helpingConditions, cond.Name):
+			modify(2, cond.Name)
+		}
+	}
+	if state.PlayerStatus.Health < 30 {
+		modify(-2, "low health")
+	}
+	if skill.physical && state.PlayerStatus.Stamina < 20 {
+		modify(-2, "low stamina")
+	}
+
+	helped, heavy := 0, 0
+	for _, item := range state.Inventory {
+		if helped < 2 && slices.ContainsFunc(item.Properties, func(p string) bool { return containsWord(skill.helpers, p) }) {
+			modify(2, item.Name)
+			helped++
+		}
+		if skill.physical && slices.ContainsFunc(item.Properties, func(p string) bool { return strings.EqualFold(p, "heavy") }) {
+			heavy++
+		}
+	}
+	if heavy > 0 {
+		modify(-min(heavy, 2), "heavy load")
+	}
+
+	c.Roll = rollD20(seed, turn, c.Skill)
+	switch total := c.Total(); {
+	case c.Roll == 20, c.Roll != 1 && total >= c.Target:
+		c.Verdict = VerdictSuccess
+	case c.Roll != 1 && total >= c.Target-partialMargin:
+		c.Verdict = VerdictPartial
+	default:
+		c.Verdict = VerdictFailure
+	}
+	return c
+}
+
+// rollD20 rolls a twenty-sided die determined by the seed, turn and skill.
+func rollD20(seed uint64, turn int, skill string) int {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d|%s", turn, skill)
+	return rand.New(rand.NewPCG(seed, h.Sum64())).IntN(20) + 1
+}
+
+// containsWord reports whether s, ignoring case, is one of words.
+func containsWord(words []string, s string) bool {
+	return slices.ContainsFunc(words, func(w string) bool { return strings.EqualFold(w, s) })
+}
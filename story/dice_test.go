@@ -0,0 +1,33 @@
+package story
+
+import "testing"
+
+func TestResolveRollsModifiedSkillChecks(t *testing.T) {
+	state := testState()
+	if c := Resolve(state, "look around", 7, 1); c != nil {
+		t.Fatalf("safe actions need no check: %v", c)
+	}
+
+	state.PlayerStatus.Conditions = []Condition{{Name: "wounded"}}
+	state.Inventory = append(state.Inventory, Item{Name: "coil of rope", Properties: []string{"rope"}}, Item{Name: "anvil", Properties: []string{"heavy"}})
+	c := Resolve(state, "climb the wall", 7, 1)
+	if c == nil || c.Skill != "athletics" || c.Target != 11 {
+		t.Fatalf("expected an athletics check against 11: %v", c)
+	}
+	// wounded -2, rope +2, heavy load -1
+	if c.Modifier != -1 || len(c.Modifiers) != 3 {
+		t.Errorf("unexpected modifiers %d %v", c.Modifier, c.Modifiers)
+	}
+	if again := Resolve(state, "Scale the WALL quickly", 7, 1); again.Roll != c.Roll || again.Verdict != c.Verdict {
+		t.Errorf("rewording the action should not reroll it: %v then %v", c, again)
+	}
+
+	state.Rules.ConsequenceModel = "punishing"
+	rolls := map[Verdict]bool{}
+	for turn := range 200 {
+		rolls[Resolve(state, "climb the wall", 7, turn).Verdict] = true
+	}
+	if len(rolls) != 3 {
+		t.Errorf("expected every verdict over many turns: %v", rolls)
+	}
+}
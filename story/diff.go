@@ -0,0 +1,156 @@
+package story
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// StateDiff lists what changed in the game state over one turn.
+type StateDiff struct {
+	HealthDelta      int
+	StaminaDelta     int
+	ConditionsGained []string
+	ConditionsLost   []string
+	ItemsAdded       []string
+	ItemsRemoved     []string
+	NPCChanges       []NPCChange
+	PuzzlesSolved    []string
+	LocationFrom     string
+	LocationTo       string
+	TensionDelta     int
+}
+
+// NPCChange is a change in an NPC's disposition.
+type NPCChange struct {
+	Name string
+	From string
+	To   string
+}
+
+// Clone returns a copy of the diff that shares no slices with the original.
+func (d StateDiff) Clone() StateDiff {
+	d.ConditionsGained = slices.Clone(d.ConditionsGained)
+	d.ConditionsLost = slices.Clone(d.ConditionsLost)
+	d.ItemsAdded = slices.Clone(d.ItemsAdded)
+	d.ItemsRemoved = slices.Clone(d.ItemsRemoved)
+	d.NPCChanges = slices.Clone(d.NPCChanges)
+	d.PuzzlesSolved = slices.Clone(d.PuzzlesSolved)
+	return d
+}
+
+// Moved reports whether the player changed location.
+func (d StateDiff) Moved() bool {
+	return d.LocationTo != ""
+}
+
+// Empty reports whether nothing changed.
+func (d StateDiff) Empty() bool {
+	return d.HealthDelta == 0 && d.StaminaDelta == 0 && d.TensionDelta == 0 && !d.Moved() &&
+		len(d.ConditionsGained) == 0 && len(d.ConditionsLost) == 0 &&
+		len(d.ItemsAdded) == 0 && len(d.ItemsRemoved) == 0 &&
+		len(d.NPCChanges) == 0 && len(d.PuzzlesSolved) == 0
+}
+
+// Diff compares the state before and after a turn. A puzzle counts as solved when its
+// status becomes "solved" or it leaves the puzzles array, as the model is told to do.
+func Diff(before, after *GameState) StateDiff {
+	var d StateDiff
+	if before == nil || after == nil {
+		return d
+	}
+
+	d.HealthDelta = after.PlayerStatus.Health - before.PlayerStatus.Health
+	d.StaminaDelta = after.PlayerStatus.Stamina - before.PlayerStatus.Stamina
+	d.TensionDelta = after.World.WorldTension - before.World.WorldTension
+	d.ConditionsGained, d.ConditionsLost = diffNames(ConditionNames(before.PlayerStatus.Conditions), ConditionNames(after.PlayerStatus.Conditions))
+	d.ItemsAdded, d.ItemsRemoved = diffNames(itemNames(before.Inventory), itemNames(after.Inventory))
+
+	if from, to := before.Environment.LocationName, after.Environment.LocationName; to != "" && !strings.EqualFold(from, to) {
+		d.LocationFrom, d.LocationTo = from, to
+	}
+
+	dispositions := make(map[string]string, len(before.NPCs))
+	for _, npc := range before.NPCs {
+		dispositions[strings.ToLower(npc.Name)] = npc.Disposition
+	}
+	for _, npc := range after.NPCs {
+		from, ok := dispositions[strings.ToLower(npc.Name)]
+		if ok && from != "" && !strings.EqualFold(from, npc.Disposition) {
+			d.NPCChanges = append(d.NPCChanges, NPCChange{Name: npc.Name, From: from, To: npc.Disposition})
+		}
+	}
+
+	remaining := make(map[string]Puzzle, len(after.Puzzles))
+	for _, puzzle := range after.Puzzles {
+		remaining[strings.ToLower(puzzle.Name)] = puzzle
+	}
+	for _, puzzle := range before.Puzzles {
+		if puzzleSolved(puzzle) {
+			continue
+		}
+		if now, ok := remaining[strings.ToLower(puzzle.Name)]; !ok || puzzleSolved(now) {
+			d.PuzzlesSolved = append(d.PuzzlesSolved, puzzle.Name)
+		}
+	}
+	return d
+}
+
+// Mismatches cross-checks the inventory changes against the items the model reported
+// adding and removing, and describes each disagreement.
+func (d StateDiff) Mismatches(reportedAdded, reportedRemoved []string) []string {
+	var problems []string
+	reportedOnly, unreported := diffNames(d.ItemsAdded, reportedAdded)
+	for _, name := range unreported {
+		problems = append(problems, fmt.Sprintf("%q was added without being reported", name))
+	}
+	for _, name := range reportedOnly {
+		problems = append(problems, fmt.Sprintf("%q was reported added but is not in the inventory", name))
+	}
+	reportedOnly, unreported = diffNames(d.ItemsRemoved, reportedRemoved)
+	for _, name := range unreported {
+		problems = append(problems, fmt.Sprintf("%q was removed without being reported", name))
+	}
+	for _, name := range reportedOnly {
+		problems = append(problems, fmt.Sprintf("%q was reported removed but is still in the inventory", name))
+	}
+	return problems
+}
+
+// puzzleSolved reports whether a puzzle's status marks it as solved.
+func puzzleSolved(p Puzzle) bool {
+	return strings.EqualFold(p.Status, "solved")
+}
+
+// itemNames returns the names of the given items.
+func itemNames(items []Item) []string {
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = item.Name
+	}
+	return names
+}
+
+// diffNames returns the names only in after (gained) and only in before (lost),
+// compared case-insensitively and in their original order.
+func diffNames(before, after []string) (gained, lost []string) {
+	had := make(map[string]bool, len(before))
+	for _, name := range before {
+		had[strings.ToLower(name)] = true
+	}
+	has := make(map[string]bool, len(after))
+	for _, name := range after {
+		has[strings.ToLower(name)] = true
+	}
+	for _, name := range after {
+		if !had[strings.ToLower(name)] {
+			gained = append(gained, name)
+		}
+	}
+	for _, name := range before {
+		if !has[strings.ToLower(name)] {
+			lost = append(lost, name)
+		}
+	}
+	return gained, lost
+}
@@ -0,0 +1,16 @@
+package story
+
+import "testing"
+
+func TestDiffSolvedPuzzles(t *testing.T) {
+	before := &GameState{Puzzles: []Puzzle{{Name: "Locked Door", Status: "unsolved"}, {Name: "Riddle", Status: "unsolved"}, {Name: "Old Lever", Status: "solved"}}}
+	after := &GameState{Puzzles: []Puzzle{{Name: "Riddle", Status: "solved"}}}
+
+	d := Diff(before, after)
+	if len(d.PuzzlesSolved) != 2 || d.PuzzlesSolved[0] != "Locked Door" || d.PuzzlesSolved[1] != "Riddle" {
+		t.Errorf("PuzzlesSolved = %v", d.PuzzlesSolved)
+	}
+	if !Diff(before, before).Empty() {
+		t.Error("a state compared with itself should have no changes")
+	}
+}
@@ -0,0 +1,145 @@
+package story
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Limits the game state is held to after every turn. Tension may reach the climax
+// threshold of 125 but not pass it.
+const (
+	MaxHealth  = 100
+	MaxStamina = 100
+	MaxTension = 125
+)
+
+// Invariant names, as logged and counted in metrics.
+const (
+	InvariantHealthRange  = "hp_range"
+	InvariantStaminaRange = "sp_range"
+	InvariantTensionRange = "tension_range"
+	InvariantDifficulty   = "difficulty"
+	InvariantCharacter    = "character"
+	InvariantWonAndLost   = "won_and_lost"
+	InvariantGameOver     = "game_over"
+	InvariantDroppedItems = "dropped_items"
+)
+
+// Correction is one invariant a turn broke and how it was repaired. Severe corrections
+// change the outcome of the turn, so the story text probably describes the broken state
+// and the model should be asked again before the repair is applied.
+type Correction struct {
+	Invariant string
+	Detail    string
+	Severe    bool
+}
+
+// Enforcement is the result of holding a turn to the game-state invariants.
+type Enforcement struct {
+	GameOver    bool
+	Corrections []Correction
+}
+
+// Severe returns the corrections that call for re-asking the model.
+func (e Enforcement) Severe() []Correction {
+	var severe []Correction
+	for _, c := range e.Corrections {
+		if c.Severe {
+			severe = append(severe, c)
+		}
+	}
+	return severe
+}
+
+// Enforce repairs after in place so it follows the game-state invariants: stats stay in
+// range, the difficulty and character never change, a game is never both won and lost, items are not
+// silently dropped, and game over agrees with hp and the win/loss flags. gameOver is the
+// model's game_over flag and reportedRemoved its items_removed list.
+func Enforce(before, after *GameState, gameOver bool, reportedRemoved []string) Enforcement {
+	e := Enforcement{GameOver: gameOver}
+	if after == nil {
+		return e
+	}
+	correct := func(invariant string, severe bool, format string, args ...any) {
+		e.Corrections = append(e.Corrections, Correction{Invariant: invariant, Detail: fmt.Sprintf(format, args...), Severe: severe})
+	}
+
+	if hp := clamp(after.PlayerStatus.Health, 0, MaxHealth); hp != after.PlayerStatus.Health {
+		correct(InvariantHealthRange, false, "hp %d is outside 0-%d", after.PlayerStatus.Health, MaxHealth)
+		after.PlayerStatus.Health = hp
+	}
+	if sp := clamp(after.PlayerStatus.Stamina, 0, MaxStamina); sp != after.PlayerStatus.Stamina {
+		correct(InvariantStaminaRange, false, "sp %d is outside 0-%d", after.PlayerStatus.Stamina, MaxStamina)
+		after.PlayerStatus.Stamina = sp
+	}
+	if tension := clamp(after.World.WorldTension, 0, MaxTension); tension != after.World.WorldTension {
+		correct(InvariantTensionRange, false, "tension %d is outside 0-%d", after.World.WorldTension, MaxTension)
+		after.World.WorldTension = tension
+	}
+
+	if before != nil {
+		if model := before.Rules.ConsequenceModel; model != "" && after.Rules.ConsequenceModel != model {
+			correct(InvariantDifficulty, false, "difficulty cannot change from %s to %q mid-game", model, after.Rules.ConsequenceModel)
+			after.Rules.ConsequenceModel = model
+		}
+		// The model may leave the character out; only rewriting it counts as a correction.
+		if before.Character != nil && !before.Character.Equal(after.Character) {
+			if after.Character != nil {
+				correct(InvariantCharacter, false, "the character cannot change from %s to %s", before.Character.Name, after.Character.Name)
+			}
+			after.Character = before.Character.Clone()
+		}
+		if dropped := silentlyDropped(before.Inventory, after.Inventory, reportedRemoved); len(dropped) >= 2 && 2*len(dropped) >= len(before.Inventory) {
+			names := itemNames(dropped)
+			correct(InvariantDroppedItems, true, "%d of %d items left the inventory without being removed: %s", len(dropped), len(before.Inventory), strings.Join(names, ", "))
+			after.Inventory = append(after.Inventory, dropped...)
+		}
+	}
+
+	if after.GameWon && after.GameLost {
+		correct(InvariantWonAndLost, true, "the game cannot be both won and lost")
+		after.GameWon = false
+	}
+	switch {
+	case after.PlayerStatus.Health <= 0 && (!after.GameLost || !e.GameOver):
+		correct(InvariantGameOver, false, "hp is %d, so the game is over and lost", after.PlayerStatus.Health)
+		after.GameLost, after.GameWon, e.GameOver = true, false, true
+	case (after.GameWon || after.GameLost) && !e.GameOver:
+		correct(InvariantGameOver, false, "a won or lost game must be over")
+		e.GameOver = true
+	case e.GameOver && !after.GameWon && !after.GameLost:
+		correct(InvariantGameOver, false, "a game that is over must be won or lost")
+		after.GameLost = true
+	}
+	return e
+}
+
+// silentlyDropped returns the items in before that are missing from after without
+// being listed in reportedRemoved.
+func silentlyDropped(before, after []Item, reportedRemoved []string) []Item {
+	kept := make(map[string]bool, len(after)+len(reportedRemoved))
+	for _, item := range after {
+		kept[strings.ToLower(item.Name)] = true
+	}
+	for _, name := range reportedRemoved {
+		kept[strings.ToLower(name)] = true
+	}
+	var dropped []Item
+	for _, item := range before {
+		if !kept[strings.ToLower(item.Name)] {
+			item.Properties = append([]string(nil), item.Properties...)
+			dropped = append(dropped, item)
+		}
+	}
+	return dropped
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
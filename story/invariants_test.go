@@ -0,0 +1,25 @@
+package story
+
+import "testing"
+
+func TestEnforceRepairsGameState(t *testing.T) {
+	before := testState()
+	after := before.Clone()
+	after.PlayerStatus.Health = 250
+	after.PlayerStatus.Stamina = -20
+	after.Rules.ConsequenceModel = "exploratory"
+
+	result := Enforce(before, after, false, nil)
+	if after.PlayerStatus.Health != MaxHealth || after.PlayerStatus.Stamina != 0 || after.Rules.ConsequenceModel != "challenging" {
+		t.Errorf("state was not repaired: %+v %+v", after.PlayerStatus, after.Rules)
+	}
+	if len(result.Corrections) != 3 || len(result.Severe()) != 0 || result.GameOver {
+		t.Errorf("unexpected corrections: %+v", result)
+	}
+
+	after = before.Clone()
+	after.PlayerStatus.Health = -5
+	if result = Enforce(before, after, false, nil); !result.GameOver || !after.GameLost || after.PlayerStatus.Health != 0 {
+		t.Errorf("hp <= 0 should end the game as lost: %+v %+v", result, after)
+	}
+}
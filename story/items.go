@@ -0,0 +1,244 @@
+package story
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Equipment slots an item can be worn or wielded in. Only one item can be equipped in
+// each slot.
+var EquipSlots = []string{"head", "body", "hand", "offhand", "feet", "neck"}
+
+// carryLimits is the total weight the player can carry on each difficulty.
+var carryLimits = map[string]int{
+	"exploratory": 50,
+	"challenging": 35,
+	"punishing":   25,
+}
+
+// Item weights and wear.
+const (
+	MaxDurability   = 100
+	MaxItemWeight   = 200
+	UntrackedWeight = 1  // The weight of an item the model gave none
+	HeavyWeight     = 15 // The weight of an untracked item with the "heavy" property
+	defaultCarry    = 35
+	successWear     = 5
+	partialWear     = 10
+	failureWear     = 20
+)
+
+// useAction matches actions that use up a charge of the item they name.
+var useAction = regexp.MustCompile(`(?i)\b(use|using|drink|eat|quaff|consume|read|light|fire|shoot|throw|swing|apply|cast|play|pour|spray|blow|ring|wave|strike|activate)\b`)
+
+// CarryLimit returns the total weight the player can carry on a difficulty.
+func CarryLimit(consequenceModel string) int {
+	if limit, ok := carryLimits[consequenceModel]; ok {
+		return limit
+	}
+	return defaultCarry
+}
+
+// Load is the weight an item counts for against the carry limit.
+func (i Item) Load() int {
+	switch {
+	case i.Weight > 0:
+		return i.Weight
+	case slices.ContainsFunc(i.Properties, func(p string) bool { return strings.EqualFold(p, "heavy") }):
+		return HeavyWeight
+	}
+	return UntrackedWeight
+}
+
+// TotalLoad is the weight of everything in an inventory.
+func TotalLoad(items []Item) int {
+	total := 0
+	for _, item := range items {
+		total += item.Load()
+	}
+	return total
+}
+
+// ItemChanges is what the server did to the inventory at the end of a turn.
+type ItemChanges struct {
+	UsedUp     []string // Items that ran out of charges
+	Broken     []string // Items whose durability ran out
+	LeftBehind []string // Items too heavy to carry, left where they were found
+	Unequipped []string // Items taken off to free their slot for another
+}
+
+// Removed lists the carried items the server took out of the inventory.
+func (c ItemChanges) Removed() []string {
+	return slices.Concat(c.UsedUp, c.Broken)
+}
+
+// Empty reports whether the server changed nothing.
+func (c ItemChanges) Empty() bool {
+	return len(c.UsedUp) == 0 && len(c.Broken) == 0 && len(c.LeftBehind) == 0 && len(c.Unequipped) == 0
+}
+
+// Narration tells the player what happened to their items, one sentence per change.
+func (c ItemChanges) Narration() []string {
+	var lines []string
+	for _, name := range c.UsedUp {
+		lines = append(lines, fmt.Sprintf("The %s is used up.", name))
+	}
+	for _, name := range c.Broken {
+		lines = append(lines, fmt.Sprintf("The %s breaks.", name))
+	}
+	for _, name := range c.LeftBehind {
+		lines = append(lines, fmt.Sprintf("The %s is too heavy to carry with everything else, so you leave it behind.", name))
+	}
+	for _, name := range c.Unequipped {
+		lines = append(lines, fmt.Sprintf("You put away the %s.", name))
+	}
+	return lines
+}
+
+// SettleItems ends a turn for the inventory, changing after in place. Charges and
+// durability the model forgot are restored. An item named in an action that uses it,
+// and a lit or burning item, spends a charge, and is gone when it has none left. Items
+// that helped with, or were named in, a skill check wear by how well it went, and break
+// at no durability. Only one item stays equipped per slot, and new items that take the
+// load over the difficulty's carry limit are left in the room.
+func SettleItems(before, after *GameState, action string, check *Check) ItemChanges {
+	var c ItemChanges
+	if after == nil {
+		return c
+	}
+	had := make(map[string]Item)
+	if before != nil {
+		for _, item := range before.Inventory {
+			had[strings.ToLower(item.Name)] = item
+		}
+	}
+
+	wear := 0
+	if check != nil {
+		wear = map[Verdict]int{VerdictSuccess: successWear, VerdictPartial: partialWear, VerdictFailure: failureWear}[check.Verdict]
+	}
+	kept := make([]Item, 0, len(after.Inventory))
+	for _, item := range after.Inventory {
+		item = normaliseItem(item)
+		prev, carried := had[strings.ToLower(item.Name)]
+		if !carried {
+			kept = append(kept, item)
+			continue
+		}
+		if item.Charges == 0 {
+			item.Charges = prev.Charges
+		}
+		if item.Durability == 0 {
+			item.Durability = prev.Durability
+		}
+		if item.Weight == 0 {
+			item.Weight = prev.Weight
+		}
+
+		named := namesItem(action, item.Name)
+		if item.Charges > 0 && ((named && useAction.MatchString(action)) || burning(item)) {
+			item.Charges--
+			if item.Charges == 0 {
+				c.UsedUp = append(c.UsedUp, item.Name)
+				continue
+			}
+		}
+		if item.Durability > 0 && wear > 0 && (named || helped(check, item.Name)) {
+			item.Durability -= wear
+			if item.Durability <= 0 {
+				c.Broken = append(c.Broken, item.Name)
+				continue
+			}
+		}
+		kept = append(kept, item)
+	}
+
+	// One item per slot; a newly equipped item replaces the one already there.
+	for _, slot := range EquipSlots {
+		var equipped []int
+		for i, item := range kept {
+			if item.Equipped && item.Slot == slot {
+				equipped = append(equipped, i)
+			}
+		}
+		if len(equipped) < 2 {
+			continue
+		}
+		keep := equipped[0]
+		for _, i := range equipped {
+			if !had[strings.ToLower(kept[i].Name)].Equipped {
+				keep = i
+			}
+		}
+		for _, i := range equipped {
+			if i != keep {
+				kept[i].Equipped = false
+				c.Unequipped = append(c.Unequipped, kept[i].Name)
+			}
+		}
+	}
+
+	limit := CarryLimit(after.Rules.ConsequenceModel)
+	after.Rules.CarryLimit = limit
+	for i := len(kept) - 1; i >= 0 && TotalLoad(kept) > limit; i-- {
+		item := kept[i]
+		if _, carried := had[strings.ToLower(item.Name)]; carried {
+			continue
+		}
+		kept = slices.Delete(kept, i, i+1)
+		after.Environment.WorldObjects = append(after.Environment.WorldObjects, WorldObject{Name: item.Name, Properties: item.Properties, State: item.State})
+		c.LeftBehind = append(c.LeftBehind, item.Name)
+	}
+	after.Inventory = kept
+	return c
+}
+
+// normaliseItem keeps an item's structured fields within their limits.
+func normaliseItem(item Item) Item {
+	item.Charges = max(item.Charges, 0)
+	item.Durability = clamp(item.Durability, 0, MaxDurability)
+	item.Weight = clamp(item.Weight, 0, MaxItemWeight)
+	item.Slot = strings.ToLower(strings.TrimSpace(item.Slot))
+	if !slices.Contains(EquipSlots, item.Slot) {
+		item.Slot = ""
+	}
+	if item.Slot == "" {
+		item.Equipped = false
+	}
+	return item
+}
+
+// namesItem reports whether an action mentions an item by its name or the last word
+// of it, e.g. "torch" for "lit torch".
+func namesItem(action, name string) bool {
+	text := " " + strings.Join(wordsOf(action), " ") + " "
+	words := wordsOf(name)
+	if len(words) == 0 {
+		return false
+	}
+	for _, candidate := range []string{strings.Join(words, " "), words[len(words)-1]} {
+		if len(candidate) >= 3 && strings.Contains(text, " "+candidate+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+var nonWord = regexp.MustCompile(`[^\pL\pN]+`)
+
+// wordsOf splits text into lowercase words, dropping punctuation.
+func wordsOf(text string) []string {
+	return strings.Fields(nonWord.ReplaceAllString(strings.ToLower(text), " "))
+}
+
+// burning reports whether an item burns down by itself each turn, like a lit torch.
+func burning(item Item) bool {
+	return strings.EqualFold(item.State, "lit") || strings.EqualFold(item.State, "burning")
+}
+
+// helped reports whether an item modified a skill check.
+func helped(check *Check, name string) bool {
+	return check != nil && slices.ContainsFunc(check.Modifiers, func(m string) bool { return strings.HasPrefix(m, name+" ") })
+}
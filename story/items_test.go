@@ -0,0 +1,44 @@
+package story
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSettleItemsEnforcesLifecycle(t *testing.T) {
+	before := testState()
+	before.Rules.ConsequenceModel = "punishing"
+	before.Inventory = []Item{
+		{Name: "lit torch", State: "lit", Charges: 2, Weight: 1},
+		{Name: "healing potion", Charges: 1, Weight: 1},
+		{Name: "iron sword", Durability: 8, Slot: "hand", Equipped: true, Weight: 5, Properties: []string{"weapon"}},
+		{Name: "wooden club", Slot: "hand", Weight: 3},
+	}
+	after := before.Clone()
+	// The model forgot the torch's charges, equipped the club and picked up a boulder.
+	after.Inventory[0].Charges = 0
+	after.Inventory[3].Equipped = true
+	after.Inventory = append(after.Inventory, Item{Name: "boulder", Weight: 100})
+	check := &Check{Skill: "combat", Verdict: VerdictFailure, Modifiers: []string{"iron sword +2"}}
+
+	changes := SettleItems(before, after, "drink the potion", check)
+	if len(after.Inventory) != 2 || after.Inventory[0].Name != "lit torch" || after.Inventory[0].Charges != 1 {
+		t.Fatalf("unexpected inventory %+v", after.Inventory)
+	}
+	if !slices.Equal(changes.UsedUp, []string{"healing potion"}) || !slices.Equal(changes.Broken, []string{"iron sword"}) || !slices.Equal(changes.LeftBehind, []string{"boulder"}) {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+	if !after.Inventory[1].Equipped || after.Rules.CarryLimit != CarryLimit("punishing") {
+		t.Errorf("the club should stay equipped under the punishing limit: %+v %+v", after.Inventory[1], after.Rules)
+	}
+	if objs := after.Environment.WorldObjects; objs[len(objs)-1].Name != "boulder" {
+		t.Errorf("the boulder should be left in the room: %+v", objs)
+	}
+
+	// Two items in one slot: the newly equipped one stays.
+	before, after = after, after.Clone()
+	after.Inventory = append(after.Inventory, Item{Name: "short bow", Slot: "hand", Equipped: true, Weight: 2})
+	if changes := SettleItems(before, after, "look around", nil); !slices.Equal(changes.Unequipped, []string{"wooden club"}) || !slices.Equal(changes.UsedUp, []string{"lit torch"}) {
+		t.Errorf("expected the club put away and the torch burnt out: %+v %+v", changes, after.Inventory)
+	}
+}
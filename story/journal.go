@@ -0,0 +1,160 @@
+package story
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Journal records the player's progress through the story's puzzles.
+type Journal struct {
+	Solved []SolvedPuzzle
+	Clues  []Clue
+}
+
+// SolvedPuzzle is a puzzle the player overcame and the turn they did it on.
+type SolvedPuzzle struct {
+	Name        string
+	Type        string
+	Description string
+	Turn        int
+}
+
+// Clue is a solution hint the story has revealed to the player.
+type Clue struct {
+	Puzzle string
+	Text   string
+	Turn   int
+}
+
+// Obstacle is an unsolved puzzle as the player sees it, without its type or hints.
+type Obstacle struct {
+	Name        string
+	Description string
+}
+
+// JournalView is the part of the journal and game state the player may see.
+type JournalView struct {
+	Active              []Obstacle
+	Solved              []SolvedPuzzle
+	Clues               []Clue
+	Objectives          []string // Win conditions, only ever set in exploratory difficulty
+	CanRevealObjectives bool
+}
+
+// Record adds the puzzles solved and the clues discovered on a turn. A hint counts as
+// discovered once the story text mentions every significant word in it.
+func (j *Journal) Record(turn int, before, after *GameState, changes StateDiff, storyText string) {
+	if before != nil {
+		for _, name := range changes.PuzzlesSolved {
+			entry := SolvedPuzzle{Name: name, Turn: turn}
+			for _, p := range before.Puzzles {
+				if strings.EqualFold(p.Name, name) {
+					entry.Type, entry.Description = p.Type, p.Description
+				}
+			}
+			j.Solved = append(j.Solved, entry)
+		}
+	}
+	if after == nil {
+		return
+	}
+
+	text := strings.ToLower(storyMarkup.ReplaceAllString(storyText, " "))
+	for _, p := range after.Puzzles {
+		for _, hint := range p.SolutionHints {
+			if j.hasClue(p.Name, hint) || !mentionsHint(text, hint) {
+				continue
+			}
+			j.Clues = append(j.Clues, Clue{Puzzle: p.Name, Text: strings.ReplaceAll(hint, "_", " "), Turn: turn})
+		}
+	}
+}
+
+// View returns what the player may see of the journal. Active puzzles are listed by name
+// and description only; the win conditions are revealed as objectives only when asked
+// for in exploratory difficulty.
+func (j *Journal) View(state *GameState, revealObjectives bool) JournalView {
+	var v JournalView
+	if j != nil {
+		v.Solved, v.Clues = j.Solved, j.Clues
+	}
+	if state == nil {
+		return v
+	}
+	for _, p := range state.Puzzles {
+		if !puzzleSolved(p) {
+			v.Active = append(v.Active, Obstacle{Name: p.Name, Description: p.Description})
+		}
+	}
+	v.CanRevealObjectives = strings.EqualFold(state.Rules.ConsequenceModel, "exploratory")
+	if v.CanRevealObjectives && revealObjectives {
+		v.Objectives = state.WinConditions
+	}
+	return v
+}
+
+func (j *Journal) hasClue(puzzle, hint string) bool {
+	text := strings.ReplaceAll(hint, "_", " ")
+	for _, c := range j.Clues {
+		if strings.EqualFold(c.Puzzle, puzzle) && strings.EqualFold(c.Text, text) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	storyMarkup = regexp.MustCompile(`<[^>]*>`)
+	hintWords   = regexp.MustCompile(`[a-z]+`)
+)
+
+// hintFillers are words in hints like "requires_key" that the story need not mention.
+var hintFillers = map[string]bool{
+	"requires": true, "require": true, "needs": true, "need": true, "use": true, "using": true,
+	"the": true, "and": true, "with": true, "for": true, "from": true, "player": true, "must": true,
+}
+
+// mentionsHint reports whether the lowercased story text mentions every significant
+// word of a hint.
+func mentionsHint(text, hint string) bool {
+	found := false
+	for _, word := range hintWords.FindAllString(strings.ToLower(hint), -1) {
+		if len(word) < 3 || hintFillers[word] {
+			continue
+		}
+		if !strings.Contains(text, word) {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// Rewind forgets the progress made after the given turn.
+func (j *Journal) Rewind(turn int) {
+	if j == nil {
+		return
+	}
+	solved := j.Solved[:0]
+	for _, s := range j.Solved {
+		if s.Turn <= turn {
+			solved = append(solved, s)
+		}
+	}
+	clues := j.Clues[:0]
+	for _, c := range j.Clues {
+		if c.Turn <= turn {
+			clues = append(clues, c)
+		}
+	}
+	j.Solved, j.Clues = solved, clues
+}
+
+// Clone returns a copy of the journal that can be changed independently.
+func (j *Journal) Clone() *Journal {
+	if j == nil {
+		return nil
+	}
+	return &Journal{Solved: slices.Clone(j.Solved), Clues: slices.Clone(j.Clues)}
+}
@@ -9,6 +9,7 @@ type ProperNoun struct {
 
 // GameState represents the entire state of the game world.
 type GameState struct {
+	Character         *Character   `json:"char,omitempty"`
 	PlayerStatus      PlayerStatus `json:"status"`
 	Inventory         []Item       `json:"inv,omitempty"`
 	Environment       Environment  `json:"env"`
@@ -27,9 +28,9 @@ type GameState struct {
 
 // PlayerStatus tracks the player's condition.
 type PlayerStatus struct {
-	Health     int      `json:"hp"`
-	Stamina    int      `json:"sp"`
-	Conditions []string `json:"conds,omitempty"`
+	Health     int         `json:"hp"`
+	Stamina    int         `json:"sp"`
+	Conditions []Condition `json:"conds,omitempty"`
 }
 
 // Item represents an object in the player's inventory.
@@ -38,6 +39,11 @@ type Item struct {
 	Description string   `json:"desc"`
 	Properties  []string `json:"props,omitempty"`
 	State       string   `json:"state,omitempty"`
+	Charges     int      `json:"charges,omitempty"`  // Uses left; 0 if it is not used up
+	Durability  int      `json:"dur,omitempty"`      // Condition out of 100; 0 if it cannot break
+	Slot        string   `json:"slot,omitempty"`     // Where it is worn or wielded, one of EquipSlots
+	Equipped    bool     `json:"equipped,omitempty"` // Whether it is worn or wielded now
+	Weight      int      `json:"wt,omitempty"`       // Counts against the carry limit; 0 weighs UntrackedWeight
 }
 
 // Environment describes the current location and its interactive elements.
@@ -80,4 +86,53 @@ type World struct {
 // Rules defines the current rule set for the game.
 type Rules struct {
 	ConsequenceModel string `json:"model"`
+	CarryLimit       int    `json:"carry,omitempty"` // Set by the server from the difficulty
+}
+
+// Clone returns a deep copy of the game state.
+func (g *GameState) Clone() *GameState {
+	if g == nil {
+		return nil
+	}
+	c := *g
+	c.Character = g.Character.Clone()
+	c.PlayerStatus.Conditions = append([]Condition(nil), g.PlayerStatus.Conditions...)
+	c.Inventory = make([]Item, len(g.Inventory))
+	for i, item := range g.Inventory {
+		item.Properties = append([]string(nil), item.Properties...)
+		c.Inventory[i] = item
+	}
+	c.Environment = g.Environment.Clone()
+	c.NPCs = make([]NPC, len(g.NPCs))
+	for i, npc := range g.NPCs {
+		npc.Knowledge = append([]string(nil), npc.Knowledge...)
+		c.NPCs[i] = npc
+	}
+	c.Puzzles = make([]Puzzle, len(g.Puzzles))
+	for i, puzzle := range g.Puzzles {
+		puzzle.SolutionHints = append([]string(nil), puzzle.SolutionHints...)
+		c.Puzzles[i] = puzzle
+	}
+	c.ProperNouns = append([]ProperNoun(nil), g.ProperNouns...)
+	c.WinConditions = append([]string(nil), g.WinConditions...)
+	c.LossConditions = append([]string(nil), g.LossConditions...)
+	c.SolvedPuzzleTypes = append([]string(nil), g.SolvedPuzzleTypes...)
+	return &c
+}
+
+// Clone returns a deep copy of the environment.
+func (e Environment) Clone() Environment {
+	c := e
+	if e.Exits != nil {
+		c.Exits = make(map[string]string, len(e.Exits))
+		for dir, dest := range e.Exits {
+			c.Exits[dir] = dest
+		}
+	}
+	c.WorldObjects = make([]WorldObject, len(e.WorldObjects))
+	for i, obj := range e.WorldObjects {
+		obj.Properties = append([]string(nil), obj.Properties...)
+		c.WorldObjects[i] = obj
+	}
+	return c
 }
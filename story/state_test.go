@@ -0,0 +1,21 @@
+package story
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// testState loads the game state the story and handlers tests start from: a player in a
+// damp cellar carrying a lit torch, with curtains and an anvil in the room, a way up to
+// the kitchen and a friendly NPC.
+func testState() *GameState {
+	data, err := os.ReadFile("testdata/cellar.json")
+	if err != nil {
+		panic(err)
+	}
+	var state GameState
+	if err := json.Unmarshal(data, &state); err != nil {
+		panic(err)
+	}
+	return &state
+}
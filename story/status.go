@@ -0,0 +1,266 @@
+package story
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Condition is a status effect on the player. The server counts down its turns and
+// applies its per-turn effects at the end of every turn.
+type Condition struct {
+	Name     string `json:"name"`
+	Severity int    `json:"sev,omitempty"`   // 1 mild, 2 serious, 3 severe
+	Turns    int    `json:"turns,omitempty"` // Turns left; 0 lasts until removed
+	Health   int    `json:"hp,omitempty"`    // hp change per turn, e.g. -5 for poison
+	Stamina  int    `json:"sp,omitempty"`    // sp change per turn
+}
+
+// UnmarshalJSON accepts a bare condition name as well as an object, since the model
+// sometimes writes conditions the old way.
+func (c *Condition) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*c = Condition{Name: name}
+		return nil
+	}
+	type plain Condition
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+// Effect describes the condition's per-turn effect, e.g. "-5 hp", or "" if it has none.
+func (c Condition) Effect() string {
+	var parts []string
+	if c.Health != 0 {
+		parts = append(parts, fmt.Sprintf("%+d hp", c.Health))
+	}
+	if c.Stamina != 0 {
+		parts = append(parts, fmt.Sprintf("%+d sp", c.Stamina))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// knownConditions are the defaults for conditions the model names without details.
+var knownConditions = map[string]Condition{
+	"poisoned":   {Severity: 2, Turns: 4, Health: -5},
+	"bleeding":   {Severity: 2, Turns: 3, Health: -4},
+	"burning":    {Severity: 3, Turns: 2, Health: -8},
+	"sick":       {Severity: 1, Turns: 5, Health: -1, Stamina: -3},
+	"wounded":    {Severity: 2},
+	"injured":    {Severity: 2},
+	"exhausted":  {Severity: 2},
+	"stunned":    {Severity: 2, Turns: 1},
+	"frightened": {Severity: 1, Turns: 3},
+	"drunk":      {Severity: 1, Turns: 4},
+	"wet":        {Severity: 1, Turns: 3, Stamina: -2},
+	"cold":       {Severity: 1, Stamina: -3},
+	"blessed":    {Severity: 1, Turns: 5},
+	"inspired":   {Severity: 1, Turns: 3},
+	"rested":     {Severity: 1, Turns: 3, Stamina: 5},
+	"hasted":     {Severity: 1, Turns: 2},
+}
+
+// Limits on the conditions the model may invent.
+const (
+	MaxSeverity       = 3
+	MaxConditionTurns = 10
+	MaxConditionTick  = 10
+)
+
+// The stamina economy. Exertion costs stamina, resting recovers it, and calm turns
+// recover a little. An action that costs more than the player has takes the rest
+// from their health, and running out leaves them exhausted until they recover.
+const (
+	CalmRecovery       = 3
+	RestRecovery       = 25
+	StrainCost         = 5
+	ExhaustionRecovers = 30
+	Exhausted          = "exhausted"
+)
+
+// skillExertion is the stamina a skill check costs.
+var skillExertion = map[string]int{
+	"combat":    10,
+	"athletics": 10,
+	"strength":  8,
+	"agility":   8,
+	"stealth":   4,
+}
+
+var (
+	strainAction = regexp.MustCompile(`(?i)\b(run|sprint|dig|carry|drag|row|chase|hurry|push|pull|haul)\b`)
+	restAction   = regexp.MustCompile(`(?i)\b(rest|sleep|nap|relax|meditate|camp|sit down|lie down|catch (my|your|our) breath)\b`)
+)
+
+// StatusTick is what the server did to the player's status at the end of a turn.
+type StatusTick struct {
+	Spent     int      // Stamina spent on the action
+	Recovered int      // Stamina recovered
+	Strain    int      // Health lost to exertion beyond the player's stamina
+	Effects   []string // Per-turn condition effects applied, e.g. "poisoned -5 hp"
+	WoreOff   []string // Conditions that ran out or were recovered from
+}
+
+// Empty reports whether the tick changed nothing.
+func (t StatusTick) Empty() bool {
+	return t.Spent == 0 && t.Recovered == 0 && t.Strain == 0 && len(t.Effects) == 0 && len(t.WoreOff) == 0
+}
+
+// Tick ends a turn for the player's status, changing after in place: conditions tick
+// as in TickConditions, and the action's exertion, or rest, is settled against stamina.
+// check is the turn's skill check, if any.
+func Tick(before, after *GameState, action string, check *Check) StatusTick {
+	var t StatusTick
+	if before == nil || after == nil {
+		return t
+	}
+	t.tickConditions(before, after)
+	t.spendStamina(&after.PlayerStatus, action, check)
+	t.updateExhaustion(&after.PlayerStatus)
+	return t
+}
+
+// TickConditions ends a turn for the player's conditions, changing after in place.
+// Conditions the player already had keep the server's count of their turns, unless the
+// model made them worse; they apply their effects and count down, and are removed when
+// they run out. New conditions take the known defaults for their name. Players out of
+// stamina become exhausted until they recover.
+func TickConditions(before, after *GameState) StatusTick {
+	var t StatusTick
+	if before == nil || after == nil {
+		return t
+	}
+	t.tickConditions(before, after)
+	t.updateExhaustion(&after.PlayerStatus)
+	return t
+}
+
+func (t *StatusTick) tickConditions(before, after *GameState) {
+	status := &after.PlayerStatus
+
+	had := make(map[string]Condition, len(before.PlayerStatus.Conditions))
+	for _, c := range before.PlayerStatus.Conditions {
+		had[strings.ToLower(c.Name)] = c
+	}
+	seen := make(map[string]bool, len(status.Conditions))
+	conditions := make([]Condition, 0, len(status.Conditions))
+	for _, c := range status.Conditions {
+		key := strings.ToLower(strings.TrimSpace(c.Name))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		prev, lasting := had[key]
+		if !lasting || c.Severity > prev.Severity {
+			conditions = append(conditions, newCondition(c))
+			continue
+		}
+		if effect := prev.Effect(); effect != "" {
+			status.Health += prev.Health
+			status.Stamina += prev.Stamina
+			t.Effects = append(t.Effects, prev.Name+" "+effect)
+		}
+		if prev.Turns > 0 {
+			prev.Turns--
+			if prev.Turns == 0 {
+				t.WoreOff = append(t.WoreOff, prev.Name)
+				continue
+			}
+		}
+		conditions = append(conditions, prev)
+	}
+	status.Conditions = conditions
+}
+
+// spendStamina charges the action's exertion, taking what the player lacks from their
+// health, or recovers stamina if the action was restful or calm.
+func (t *StatusTick) spendStamina(status *PlayerStatus, action string, check *Check) {
+	cost := exertion(action, check)
+	switch {
+	case cost > status.Stamina:
+		t.Spent, t.Strain = max(status.Stamina, 0), cost-max(status.Stamina, 0)
+		status.Stamina = 0
+		status.Health -= t.Strain
+	case cost > 0:
+		t.Spent = cost
+		status.Stamina -= cost
+	default:
+		recovery := CalmRecovery
+		if restAction.MatchString(action) {
+			recovery = RestRecovery
+		}
+		t.Recovered = min(recovery, max(MaxStamina-status.Stamina, 0))
+		status.Stamina += t.Recovered
+	}
+}
+
+// updateExhaustion makes a player out of stamina exhausted, and lifts it once they have
+// recovered enough.
+func (t *StatusTick) updateExhaustion(status *PlayerStatus) {
+	exhausted := status.HasCondition(Exhausted)
+	switch {
+	case status.Stamina <= 0 && !exhausted:
+		status.Conditions = append(status.Conditions, newCondition(Condition{Name: Exhausted}))
+	case status.Stamina >= ExhaustionRecovers && exhausted:
+		status.RemoveCondition(Exhausted)
+		t.WoreOff = append(t.WoreOff, Exhausted)
+	}
+}
+
+// exertion is the stamina an action costs: its skill check's, or a little for other
+// strenuous actions.
+func exertion(action string, check *Check) int {
+	if check != nil {
+		return skillExertion[check.Skill]
+	}
+	if strainAction.MatchString(action) {
+		return StrainCost
+	}
+	return 0
+}
+
+// newCondition fills in a condition the player has just gained. Known conditions named
+// without details take their defaults; the rest are kept within limits.
+func newCondition(c Condition) Condition {
+	c.Name = strings.TrimSpace(c.Name)
+	if known, ok := knownConditions[strings.ToLower(c.Name)]; ok && c.Severity == 0 && c.Turns == 0 && c.Health == 0 && c.Stamina == 0 {
+		known.Name = c.Name
+		return known
+	}
+	c.Severity = clamp(c.Severity, 1, MaxSeverity)
+	c.Turns = clamp(c.Turns, 0, MaxConditionTurns)
+	c.Health = clamp(c.Health, -MaxConditionTick, MaxConditionTick)
+	c.Stamina = clamp(c.Stamina, -MaxConditionTick, MaxConditionTick)
+	return c
+}
+
+// HasCondition reports whether the player has the named condition.
+func (s *PlayerStatus) HasCondition(name string) bool {
+	for _, c := range s.Conditions {
+		if strings.EqualFold(c.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveCondition removes the named condition, if the player has it.
+func (s *PlayerStatus) RemoveCondition(name string) {
+	kept := s.Conditions[:0]
+	for _, c := range s.Conditions {
+		if !strings.EqualFold(c.Name, name) {
+			kept = append(kept, c)
+		}
+	}
+	s.Conditions = kept
+}
+
+// ConditionNames returns the names of the given conditions.
+func ConditionNames(conditions []Condition) []string {
+	names := make([]string, len(conditions))
+	for i, c := range conditions {
+		names[i] = c.Name
+	}
+	return names
+}
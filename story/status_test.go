@@ -0,0 +1,53 @@
+package story
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTickAppliesConditionsAndStamina(t *testing.T) {
+	var status PlayerStatus
+	if err := json.Unmarshal([]byte(`{"hp":80,"sp":30,"conds":["poisoned",{"name":"cursed","sev":9,"turns":50,"hp":-40}]}`), &status); err != nil {
+		t.Fatal(err)
+	}
+	before := testState()
+	after := before.Clone()
+	after.PlayerStatus = status
+
+	// New conditions take their defaults, or are kept in bounds, but do not tick yet.
+	Tick(before, after, "look around", nil)
+	poison, curse := after.PlayerStatus.Conditions[0], after.PlayerStatus.Conditions[1]
+	if poison.Turns != 4 || poison.Health != -5 || curse.Severity != MaxSeverity || curse.Turns != MaxConditionTurns || curse.Health != -MaxConditionTick {
+		t.Fatalf("unexpected new conditions %+v %+v", poison, curse)
+	}
+	if after.PlayerStatus.Health != 80 || after.PlayerStatus.Stamina != 30+CalmRecovery {
+		t.Errorf("a calm turn should only recover stamina: %+v", after.PlayerStatus)
+	}
+
+	// The model echoing the bare name back does not reset the server's count.
+	before, after = after, after.Clone()
+	after.PlayerStatus.Conditions = []Condition{{Name: "poisoned"}}
+	tick := Tick(before, after, "climb the wall", &Check{Skill: "athletics"})
+	if got := after.PlayerStatus.Conditions[0]; got.Turns != 3 || after.PlayerStatus.Health != 75 {
+		t.Errorf("poison should tick once: %+v hp %d", got, after.PlayerStatus.Health)
+	}
+	if tick.Spent != 10 || after.PlayerStatus.Stamina != 23 || len(tick.Effects) != 1 {
+		t.Errorf("climbing should cost stamina: %+v %+v", tick, after.PlayerStatus)
+	}
+
+	// Overexertion costs health and exhausts the player until they rest.
+	before, after = after, after.Clone()
+	after.PlayerStatus.Conditions = nil
+	after.PlayerStatus.Stamina = 4
+	tick = Tick(before, after, "attack the guard", &Check{Skill: "combat"})
+	if tick.Strain != 6 || after.PlayerStatus.Health != 69 || !after.PlayerStatus.HasCondition(Exhausted) {
+		t.Errorf("expected strain and exhaustion: %+v %+v", tick, after.PlayerStatus)
+	}
+	for range 2 {
+		before, after = after, after.Clone()
+		tick = Tick(before, after, "rest by the fire", nil)
+	}
+	if after.PlayerStatus.Stamina != 2*RestRecovery || after.PlayerStatus.HasCondition(Exhausted) || tick.WoreOff[0] != Exhausted {
+		t.Errorf("resting should recover from exhaustion: %+v %+v", tick, after.PlayerStatus)
+	}
+}
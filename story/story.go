@@ -1,6 +1,37 @@
 package story
 
+import "slices"
+
 type StoryPage struct {
-	Prompt   string
-	Response string
+	Prompt     string
+	Response   string
+	Changes    StateDiff  // What the turn changed in the game state
+	Mismatches []string   // Disagreements between Changes and the items the model reported
+	Check      *Check     // The skill check rolled for the player's action, if it was risky
+	State      *GameState // The game state after this page, for rewinding; nil on error pages
+}
+
+// Clone returns a copy of the page that shares no slices or pointers with the original.
+func (p StoryPage) Clone() StoryPage {
+	p.Changes = p.Changes.Clone()
+	p.Mismatches = slices.Clone(p.Mismatches)
+	p.Check = p.Check.Clone()
+	p.State = p.State.Clone()
+	return p
+}
+
+// rewindLimits caps how often a story may be rewound on each difficulty. Difficulties
+// not listed have no limit.
+var rewindLimits = map[string]int{
+	"challenging": 3,
+	"punishing":   0,
+}
+
+// RewindLimit returns how many times a story on the given difficulty may be rewound,
+// or -1 if there is no limit.
+func RewindLimit(consequenceModel string) int {
+	if limit, ok := rewindLimits[consequenceModel]; ok {
+		return limit
+	}
+	return -1
 }
@@ -0,0 +1,196 @@
+package story
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// WorldMap is the graph of locations the player has seen this story. Visited rooms and
+// the destinations of their exits are nodes; exits are edges.
+type WorldMap struct {
+	Nodes   []MapNode
+	Edges   []MapEdge
+	Current string
+}
+
+// MapNode is a location on the world map. Unvisited nodes are only known from an exit.
+type MapNode struct {
+	Name    string
+	Visited bool
+}
+
+// MapEdge is an exit from one location to another.
+type MapEdge struct {
+	From      string
+	To        string
+	Direction string
+}
+
+// MapPoint is a node's cell on the world map grid.
+type MapPoint struct {
+	X int
+	Y int
+}
+
+// directionOffsets places the destination of an exit relative to its room.
+var directionOffsets = map[string]MapPoint{
+	"north":     {0, -1},
+	"south":     {0, 1},
+	"east":      {1, 0},
+	"west":      {-1, 0},
+	"northeast": {1, -1},
+	"northwest": {-1, -1},
+	"southeast": {1, 1},
+	"southwest": {-1, 1},
+	"up":        {1, -1},
+	"down":      {-1, 1},
+	"n":         {0, -1},
+	"s":         {0, 1},
+	"e":         {1, 0},
+	"w":         {-1, 0},
+}
+
+// Visit records the player entering env, adding it and its exits to the map.
+func (m *WorldMap) Visit(env Environment) {
+	if env.LocationName == "" {
+		return
+	}
+	room := m.addNode(env.LocationName)
+	room.Visited = true
+	m.Current = room.Name
+	from := room.Name
+	for _, dir := range slices.Sorted(maps.Keys(env.Exits)) {
+		if env.Exits[dir] == "" {
+			continue
+		}
+		to := m.addNode(env.Exits[dir]).Name
+		m.addEdge(MapEdge{From: from, To: to, Direction: strings.ToLower(strings.TrimSpace(dir))})
+	}
+}
+
+// Node returns the node with the given name, or nil.
+func (m *WorldMap) Node(name string) *MapNode {
+	for i := range m.Nodes {
+		if strings.EqualFold(m.Nodes[i].Name, name) {
+			return &m.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// Connections returns one edge per pair of connected locations, so a corridor that can
+// be walked both ways is drawn once.
+func (m *WorldMap) Connections() []MapEdge {
+	seen := make(map[[2]string]bool)
+	var edges []MapEdge
+	for _, e := range m.Edges {
+		from, to := strings.ToLower(e.From), strings.ToLower(e.To)
+		if seen[[2]string{from, to}] || seen[[2]string{to, from}] {
+			continue
+		}
+		seen[[2]string{from, to}] = true
+		edges = append(edges, e)
+	}
+	return edges
+}
+
+// Layout places every node on a grid, following exit directions from the first room
+// visited. Exits without a compass direction, and rooms whose cell is taken, go to the
+// nearest free cell. The returned points start at 0,0.
+func (m *WorldMap) Layout() map[string]MapPoint {
+	points := make(map[string]MapPoint, len(m.Nodes))
+	if len(m.Nodes) == 0 {
+		return points
+	}
+	taken := make(map[MapPoint]bool)
+	place := func(name string, at MapPoint) {
+		for ring := 0; ; ring++ {
+			for dy := -ring; dy <= ring; dy++ {
+				for dx := -ring; dx <= ring; dx++ {
+					if max(abs(dx), abs(dy)) != ring {
+						continue
+					}
+					p := MapPoint{at.X + dx, at.Y + dy}
+					if !taken[p] {
+						taken[p] = true
+						points[name] = p
+						return
+					}
+				}
+			}
+		}
+	}
+
+	maxX := 0
+	for _, root := range m.Nodes {
+		if _, ok := points[root.Name]; ok {
+			continue
+		}
+		// Rooms not reachable from those placed so far start a new area to the right.
+		start := MapPoint{}
+		if len(points) > 0 {
+			start = MapPoint{maxX + 2, 0}
+		}
+		place(root.Name, start)
+		queue := []string{root.Name}
+		for len(queue) > 0 {
+			name := queue[0]
+			queue = queue[1:]
+			for _, e := range m.Edges {
+				from, to, offset := e.From, e.To, directionOffsets[e.Direction]
+				if e.To == name {
+					from, to, offset = e.To, e.From, MapPoint{-offset.X, -offset.Y}
+				} else if e.From != name {
+					continue
+				}
+				if _, ok := points[to]; ok {
+					continue
+				}
+				if offset == (MapPoint{}) {
+					offset = MapPoint{1, 0}
+				}
+				at := points[from]
+				place(to, MapPoint{at.X + offset.X, at.Y + offset.Y})
+				queue = append(queue, to)
+			}
+		}
+		for _, p := range points {
+			maxX = max(maxX, p.X)
+		}
+	}
+
+	minX, minY := 0, 0
+	for _, p := range points {
+		minX, minY = min(minX, p.X), min(minY, p.Y)
+	}
+	for name, p := range points {
+		points[name] = MapPoint{p.X - minX, p.Y - minY}
+	}
+	return points
+}
+
+func (m *WorldMap) addNode(name string) *MapNode {
+	if n := m.Node(name); n != nil {
+		return n
+	}
+	m.Nodes = append(m.Nodes, MapNode{Name: name})
+	return &m.Nodes[len(m.Nodes)-1]
+}
+
+func (m *WorldMap) addEdge(edge MapEdge) {
+	for i, e := range m.Edges {
+		if strings.EqualFold(e.From, edge.From) && strings.EqualFold(e.Direction, edge.Direction) {
+			m.Edges[i] = edge
+			return
+		}
+	}
+	m.Edges = append(m.Edges, edge)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,22 @@
+package story
+
+import "testing"
+
+func TestWorldMapFollowsExits(t *testing.T) {
+	var m WorldMap
+	m.Visit(Environment{LocationName: "Cellar", Exits: map[string]string{"up": "Kitchen"}})
+	m.Visit(Environment{LocationName: "Kitchen", Exits: map[string]string{"down": "Cellar", "north": "Hall"}})
+
+	if len(m.Nodes) != 3 || m.Current != "Kitchen" || m.Node("hall").Visited {
+		t.Fatalf("unexpected nodes: %+v", m)
+	}
+	if got := len(m.Connections()); got != 2 {
+		t.Errorf("expected the two-way stairs to be one connection, got %d", got)
+	}
+	want := map[string]MapPoint{"Cellar": {X: 0, Y: 2}, "Kitchen": {X: 1, Y: 1}, "Hall": {X: 1, Y: 0}}
+	for name, p := range m.Layout() {
+		if want[name] != p {
+			t.Errorf("%s placed at %+v, want %+v", name, p, want[name])
+		}
+	}
+}
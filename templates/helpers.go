@@ -2,6 +2,7 @@ package templates
 
 import (
 	"fmt"
+	"story_ai/story"
 	"strings"
 )
 
@@ -27,6 +28,85 @@ func GetHealthStatus(health int) HealthStatus {
 	}
 }
 
+// ItemBadge is a short note on an item in the inventory and the CSS class it is shown with.
+type ItemBadge struct {
+	Text  string
+	Class string
+}
+
+// ItemBadges describes an item's structured fields for the inventory: whether it is
+// equipped, its charges and, once it is worn, its condition.
+func ItemBadges(item story.Item) []ItemBadge {
+	var badges []ItemBadge
+	if item.Equipped {
+		badges = append(badges, ItemBadge{"equipped: " + item.Slot, "badge-equipped"})
+	} else if item.Slot != "" {
+		badges = append(badges, ItemBadge{item.Slot, "badge-slot"})
+	}
+	switch {
+	case item.Charges == 1:
+		badges = append(badges, ItemBadge{"1 use left", "badge-low"})
+	case item.Charges > 1:
+		badges = append(badges, ItemBadge{fmt.Sprintf("%d uses", item.Charges), "badge-charges"})
+	}
+	switch {
+	case item.Durability > 0 && item.Durability <= 25:
+		badges = append(badges, ItemBadge{"nearly broken", "badge-low"})
+	case item.Durability > 0 && item.Durability < 75:
+		badges = append(badges, ItemBadge{"worn", "badge-worn"})
+	}
+	return badges
+}
+
+// LoadClass colours the inventory's weight by how close it is to the carry limit.
+func LoadClass(inventory []story.Item, consequenceModel string) string {
+	load, limit := story.TotalLoad(inventory), story.CarryLimit(consequenceModel)
+	switch {
+	case load > limit:
+		return "load-over"
+	case 4*load >= 3*limit:
+		return "load-heavy"
+	}
+	return "load-light"
+}
+
+// GetStaminaStatus returns how rested the player is, in the same style as their health.
+func GetStaminaStatus(stamina int) HealthStatus {
+	switch {
+	case stamina >= 70:
+		return HealthStatus{"Fresh", "#a6e22e"} // Lime Green
+	case stamina >= 40:
+		return HealthStatus{"Winded", "#e6db74"} // Yellow
+	case stamina >= 20:
+		return HealthStatus{"Tired", "#fd971f"} // Orange
+	case stamina > 0:
+		return HealthStatus{"Flagging", "#f92672"} // Pink/Red
+	default:
+		return HealthStatus{"Spent", "#75715e"} // Gray
+	}
+}
+
+// severityNames describe condition severities, from 1.
+var severityNames = []string{"Mild", "Serious", "Severe"}
+
+// ConditionDetail describes a condition's severity, duration and effect for its tooltip,
+// e.g. "Serious · 3 turns left · -5 hp each turn".
+func ConditionDetail(c story.Condition) string {
+	parts := []string{severityNames[max(min(c.Severity, len(severityNames)), 1)-1]}
+	switch {
+	case c.Turns == 1:
+		parts = append(parts, "1 turn left")
+	case c.Turns > 1:
+		parts = append(parts, fmt.Sprintf("%d turns left", c.Turns))
+	default:
+		parts = append(parts, "until treated")
+	}
+	if effect := c.Effect(); effect != "" {
+		parts = append(parts, effect+" each turn")
+	}
+	return strings.Join(parts, " · ")
+}
+
 // FormatProperties creates a string from a slice of item properties.
 func FormatProperties(props []string) string {
 	if len(props) == 0 {
@@ -60,3 +140,119 @@ func VignetteStyle(tension int) string {
 
 	return style
 }
+
+// ChangeEntry is one line of a story page's change log and the CSS class it is shown with.
+type ChangeEntry struct {
+	Text  string
+	Class string
+}
+
+// FormatChanges turns a turn's state diff into short change log entries.
+func FormatChanges(d story.StateDiff) []ChangeEntry {
+	var entries []ChangeEntry
+	delta := func(label string, n int) {
+		if n == 0 {
+			return
+		}
+		class := "change-gain"
+		if n < 0 {
+			class = "change-loss"
+		}
+		entries = append(entries, ChangeEntry{fmt.Sprintf("%s %+d", label, n), class})
+	}
+
+	delta("HP", d.HealthDelta)
+	delta("SP", d.StaminaDelta)
+	for _, cond := range d.ConditionsGained {
+		entries = append(entries, ChangeEntry{"Now " + cond, "change-loss"})
+	}
+	for _, cond := range d.ConditionsLost {
+		entries = append(entries, ChangeEntry{"No longer " + cond, "change-gain"})
+	}
+	for _, name := range d.ItemsAdded {
+		entries = append(entries, ChangeEntry{"+ " + name, "item-added"})
+	}
+	for _, name := range d.ItemsRemoved {
+		entries = append(entries, ChangeEntry{name, "item-removed"})
+	}
+	for _, npc := range d.NPCChanges {
+		entries = append(entries, ChangeEntry{fmt.Sprintf("%s: %s → %s", npc.Name, npc.From, npc.To), "change-npc"})
+	}
+	for _, name := range d.PuzzlesSolved {
+		entries = append(entries, ChangeEntry{"Solved: " + name, "change-gain"})
+	}
+	if d.Moved() {
+		text := "Moved to " + d.LocationTo
+		if d.LocationFrom != "" {
+			text = fmt.Sprintf("Moved: %s → %s", d.LocationFrom, d.LocationTo)
+		}
+		entries = append(entries, ChangeEntry{text, "change-move"})
+	}
+	if d.TensionDelta != 0 {
+		entries = append(entries, ChangeEntry{fmt.Sprintf("Tension %+d", d.TensionDelta), "change-tension"})
+	}
+	return entries
+}
+
+// GenreButtonClass returns the CSS class that colours a genre's buttons.
+func GenreButtonClass(genre string) string {
+	switch genre {
+	case "sci-fi":
+		return "scifi-btn"
+	case "historical-fiction":
+		return "historical-fiction-btn"
+	}
+	return "fantasy-btn"
+}
+
+// RollLabel shows a skill check briefly, e.g. "🎲 athletics 14+2 vs 11 · partial".
+func RollLabel(c *story.Check) string {
+	return fmt.Sprintf("🎲 %s %d%+d vs %d · %s", c.Skill, c.Roll, c.Modifier, c.Target, c.Verdict)
+}
+
+// RollDetail lists what modified a skill check, for the roll's tooltip.
+func RollDetail(c *story.Check) string {
+	if len(c.Modifiers) == 0 {
+		return "No modifiers"
+	}
+	return strings.Join(c.Modifiers, ", ")
+}
+
+// BranchSummary describes one branch of a story in the branch browser.
+type BranchSummary struct {
+	ID       string
+	ParentID string
+	ForkTurn int
+	Turns    int
+	Location string
+	Won      bool
+	Lost     bool
+	Current  bool
+	Depth    int // How many forks away from the original story
+}
+
+// Status describes how the branch's story stands.
+func (b BranchSummary) Status() string {
+	switch {
+	case b.Won:
+		return "Won"
+	case b.Lost:
+		return "Lost"
+	default:
+		return "In progress"
+	}
+}
+
+// BranchColumn is one branch's pages in a side-by-side comparison.
+type BranchColumn struct {
+	ID    string
+	Pages []story.StoryPage
+}
+
+// ShortID shortens a session ID for display.
+func ShortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
@@ -42,7 +42,7 @@ func Index(title string) templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "</title><meta charset=\"UTF-8\"><meta name=\"viewport\" content=\"width=device-width, initial-scale=1.0\"><!-- Open Graph / Facebook / LinkedIn --><meta property=\"og:type\" content=\"website\"><meta property=\"og:url\" content=\"https://github.com/SeeSharpSi/story_ai\"><meta property=\"og:title\" content=\"Fable Mind - An Interactive Text-Based Adventure\"><meta property=\"og:description\" content=\"An interactive, text-based adventure game powered by Google's Gemini API. Craft a unique story, choose your genre, and survive a challenging world.\"><meta property=\"og:image\" content=\"https://github.com/user-attachments/assets/131c1b8d-5373-4e93-87e8-940b57b83e6a\"><!-- Twitter --><meta property=\"twitter:card\" content=\"summary_large_image\"><meta property=\"twitter:url\" content=\"https://github.com/SeeSharpSi/story_ai\"><meta property=\"twitter:title\" content=\"Fable Mind - An Interactive Text-Based Adventure\"><meta property=\"twitter:description\" content=\"An interactive, text-based adventure game powered by Google's Gemini API. Craft a unique story, choose your genre, and survive a challenging world.\"><meta property=\"twitter:image\" content=\"https://github.com/user-attachments/assets/131c1b8d-5373-4e93-87e8-940b57b83e6a\"><link rel=\"icon\" href=\"/static/fablemind_logo_cropped.jpg\" type=\"image/jpeg\"><script src=\"/static/htmx.min.js\"></script><link rel=\"preconnect\" href=\"https://fonts.googleapis.com\"><link rel=\"preconnect\" href=\"https://fonts.gstatic.com\" crossorigin><link href=\"https://fonts.googleapis.com/css2?family=JetBrains+Mono:ital,wght@0,400;0,700;1,400&display=swap\" rel=\"stylesheet\"><style>\n        :root {\n            --background-color: #181818;\n            /* Light Grey */\n            --primary-color: #3498db;\n            /* Default Blue */\n            --send-button-color: #3498db;\n            /* Default Blue */\n        }\n\n        .theme-fantasy {\n            --primary-color: #8e44ad;\n            /* Wisteria Purple */\n            --send-button-color: #8e44ad;\n            /* Wisteria Purple */\n        }\n\n        .theme-sci-fi {\n            --primary-color: #2980b9;\n            /* Belize Hole Blue */\n            --send-button-color: #2980b9;\n            /* Belize Hole Blue */\n        }\n\n        .theme-historical-fiction {\n            --primary-color: #c0392b;\n            /* Pomegranate Red */\n            --send-button-color: #c0392b;\n            /* Pomegranate Red */\n        }\n\n        html,\n        body {\n            overflow-x: hidden;\n        }\n\n        body {\n            font-family: 'JetBrains Mono', monospace;\n            margin: 0;\n            padding: 20px 15px;\n            background-color: var(--background-color);\n            color: #d4d4d4;\n            display: flex;\n            flex-direction: column;\n            justify-content: center;\n            align-items: center;\n            min-height: 100vh;\n            transition: background-color 0.5s;\n            box-sizing: border-box;\n        }\n\n        #main-content {\n            display: flex;\n            flex-direction: column;\n            justify-content: center;\n            align-items: center;\n            width: 100%;\n        }\n\n        #story-container {\n            max-width: 600px;\n            width: 98%;\n            background-color: #252526;\n            padding: 30px 40px 40px 40px;\n            border-radius: 8px;\n            box-shadow: 0 4px 8px rgba(0, 0, 0, 0.3);\n            text-align: center;\n            border: 1px solid #333333;\n            position: relative;\n            box-sizing: border-box;\n        }\n\n        h3 {\n            color: #ffffff;\n        }\n\n        h1 {\n            color: #ffffff;\n            margin-bottom: 10px;\n        }\n\n        .logo {\n            position: absolute;\n            top: 20px;\n            left: 20px;\n            width: 80px;\n            height: 80px;\n            border-radius: 8px;\n            opacity: 0.8;\n            transition: opacity 0.3s ease;\n        }\n\n        .logo:hover {\n            opacity: 1.0;\n            cursor: pointer;\n        }\n\n        .fullscreen-modal {\n            display: none;\n            position: fixed;\n            z-index: 1000;\n            left: 0;\n            top: 0;\n            width: 100%;\n            height: 100%;\n            background-color: rgba(0, 0, 0, 0.9);\n            justify-content: center;\n            align-items: center;\n            animation: fadeIn 0.3s ease;\n        }\n\n        .fullscreen-modal img {\n            max-width: 90%;\n            max-height: 90%;\n            border-radius: 8px;\n            box-shadow: 0 4px 20px rgba(0, 0, 0, 0.5);\n        }\n\n        .close-modal {\n            position: absolute;\n            top: 20px;\n            right: 40px;\n            color: #ffffff;\n            font-size: 40px;\n            font-weight: bold;\n            cursor: pointer;\n            transition: color 0.3s ease;\n        }\n\n        .close-modal:hover {\n            color: #cccccc;\n        }\n\n        @keyframes fadeIn {\n            from { opacity: 0; }\n            to { opacity: 1; }\n        }\n\n        /* Mobile Responsive Styles */\n        @media (max-width: 768px) {\n            .logo {\n                position: relative;\n                top: 0;\n                left: 0;\n                display: block;\n                margin: 0 auto 20px auto;\n                width: 60px;\n                height: 60px;\n            }\n\n            h1 {\n                margin-top: 10px;\n            }\n        }\n\n        .rules {\n            text-align: left;\n            margin-bottom: 30px;\n        }\n\n        .genre-buttons {\n            display: flex;\n            justify-content: center;\n            flex-wrap: wrap;\n            gap: 10px;\n            margin-top: 20px;\n        }\n\n        button {\n            font-family: 'JetBrains Mono', monospace;\n            padding: 10px 20px;\n            font-size: 1em;\n            border: 2px solid;\n            background-color: #333;\n            color: #d4d4d4;\n            border-radius: 4px;\n            cursor: pointer;\n            transition: background-color 0.3s, color 0.3s;\n            font-weight: bold;\n        }\n\n        .genre-buttons .fantasy-btn {\n            border-color: #8e44ad;\n        }\n\n        .genre-buttons .scifi-btn {\n            border-color: #2980b9;\n        }\n\n        .genre-buttons .historical-fiction-btn {\n            border-color: #c0392b;\n        }\n\n        .genre-buttons .fantasy-btn:hover {\n            background-color: #8e44ad;\n            color: white;\n        }\n\n        .genre-buttons .scifi-btn:hover {\n            background-color: #2980b9;\n            color: white;\n        }\n\n        .genre-buttons .historical-fiction-btn:hover {\n            background-color: #c0392b;\n            color: white;\n        }\n\n        /* Make the Send button less prominent */\n        #response-form button {\n            border-color: var(--send-button-color);\n        }\n\n        #response-form button:hover {\n            background-color: var(--send-button-color);\n            color: white;\n        }\n\n        /* Spinner styles */\n        .loader {\n            border: 8px solid transparent;\n            border-top: 8px solid var(--background-color);\n            border-bottom: 8px solid white;\n            border-radius: 50%;\n            width: 60px;\n            height: 60px;\n            animation: spin 1s linear infinite;\n            pointer-events: auto;\n            /* Re-enable pointer events for the spinner */\n        }\n\n        @keyframes spin {\n            0% {\n                transform: rotate(0deg);\n            }\n\n            100% {\n                transform: rotate(360deg);\n            }\n        }\n\n        /* --- General Indicator Style (for #spinner) --- */\n        /* This provides a basic, centered position for any indicator. */\n        .htmx-indicator {\n            display: none;\n            position: fixed;\n            z-index: 1000;\n        }\n\n        .htmx-request.htmx-indicator,\n        .htmx-indicator.htmx-request {\n            display: flex;\n            justify-content: center;\n            align-items: center;\n            flex-direction: column;\n            top: 50%;\n            left: 50%;\n            transform: translate(-50%, -50%);\n        }\n\n\n        /* --- Overlay-Specific Style --- */\n        /* This targets ONLY our .with-overlay class to add the background\n                   and expand it to fill the screen. */\n        .htmx-request.with-overlay,\n        .with-overlay.htmx-request {\n            top: 0;\n            left: 0;\n            width: 100%;\n            height: 100%;\n            transform: none;\n            /* Reset the default centering transform */\n            background-color: rgba(37, 37, 38, 0.7);\n        }\n\n        #loading-indicator {\n            pointer-events: none;\n            /* Allow clicks to pass through the container */\n        }\n\n        .loading-text {\n            color: #d4d4d4;\n            margin-top: 15px;\n            font-style: italic;\n            background-color: rgba(40, 40, 40, 1);\n            /* Semi-transparent dark grey */\n            padding: 15px;\n            border-radius: 8px;\n            pointer-events: auto;\n            /* Re-enable pointer events for the text */\n            margin-left: 15px;\n            margin-right: 15px;\n            text-align: center;\n        }\n\n        /* Story view styles */\n        #story-history {\n            text-align: left;\n            margin-bottom: 20px;\n            border-bottom: 1px solid #333;\n            padding-bottom: 10px;\n        }\n\n        .user-response {\n            color: #4ec9b0;\n            /* Teal */\n            font-style: italic;\n        }\n\n        .item-added {\n            color: #a6e22e;\n            /* Lime Green */\n            font-weight: bold;\n        }\n\n        .item-removed {\n            color: #f92672;\n            /* Pink/Red */\n            text-decoration: line-through;\n        }\n\n        #response-form {\n            margin-bottom: 20px;\n        }\n\n        #prompt {\n            flex-grow: 1;\n            padding: 10px;\n            border: 1px solid #333;\n            border-radius: 4px;\n            background-color: #1e1e1e;\n            color: #d4d4d4;\n            font-family: 'JetBrains Mono', monospace;\n            margin-right: 10px;\n            /* Add space between input and button */\n            box-sizing: border-box;\n            /* Prevents padding from adding to the width */\n        }\n\n        #inventory {\n            text-align: left;\n            padding: 20px;\n            background-color: #252526;\n            border-radius: 8px;\n            border: 1px solid #333;\n            margin-top: 20px;\n        }\n\n        #word-count {\n            font-size: 0.8em;\n            color: #888;\n            margin-left: 10px;\n        }\n\n        /* Difficulty selector styles */\n        .difficulty-container {\n            margin-top: 20px;\n            display: flex;\n            justify-content: center;\n            align-items: center;\n            gap: 10px;\n        }\n\n        .difficulty-label {\n            font-size: 1.2em;\n            color: #ffffff;\n        }\n\n        #difficulty-selector {\n            font-family: 'JetBrains Mono', monospace;\n            padding: 8px 30px 8px 12px;\n            /* Add padding for the arrow */\n            border-radius: 4px;\n            border: 1px solid #555;\n            background-color: #333;\n            color: #d4d4d4;\n            -webkit-appearance: none;\n            /* Remove default arrow on Chrome/Safari */\n            -moz-appearance: none;\n            /* Remove default arrow on Firefox */\n            appearance: none;\n            background-image: url(\"data:image/svg+xml,%3Csvg xmlns='http://www.w3.org/2000/svg' width='12' height='12' fill='%23d4d4d4' viewBox='0 0 16 16'%3E%3Cpath d='M7.247 11.14L2.451 5.658C1.885 5.013 2.345 4 3.204 4h9.592a1 1 0 0 1 .753 1.659l-4.796 5.48a1 1 0 0 1-1.506 0z'/%3E%3C/svg%3E\");\n            background-repeat: no-repeat;\n            background-position: right 10px center;\n            cursor: pointer;\n            transition: border-color 0.3s;\n        }\n\n        #difficulty-selector:hover {\n            border-color: #666;\n        }\n\n        #difficulty-selector:focus {\n            outline: none;\n            border-color: #ffffff;\n        }\n\n        /* Player Status Bar */\n        #player-status {\n            text-align: left;\n            margin-bottom: 20px;\n            padding: 10px;\n            background-color: #1e1e1e;\n            border: 1px solid #333;\n            border-radius: 4px;\n        }\n\n        .condition {\n            color: #fd971f;\n            /* Orange */\n            font-style: italic;\n        }\n\n        .inventory-item {\n            display: flex;\n            justify-content: space-between;\n            align-items: center;\n            padding: 8px 0;\n        }\n\n        .item-properties {\n            font-style: italic;\n            color: #888;\n            /* Faint color */\n        }\n\n        .inventory-divider {\n            border: 0;\n            height: 1px;\n            background-color: #444;\n            margin: 0;\n        }\n\n        /* Tooltip Styles */\n        .tooltip {\n            position: relative;\n            display: inline;\n            cursor: help;\n        }\n\n        .tooltip .tooltiptext {\n            visibility: hidden;\n            width: 160px;\n            background-color: #555;\n            color: #fff;\n            text-align: center;\n            border-radius: 6px;\n            padding: 5px;\n            position: absolute;\n            z-index: 1;\n            bottom: 125%;\n            left: 50%;\n            margin-left: -80px;\n            opacity: 0;\n            transition: opacity 0.3s;\n        }\n\n        .tooltip .tooltiptext.tooltip-bottom {\n            bottom: auto;\n            top: 125%;\n        }\n\n        .tooltip:hover .tooltiptext,\n        .tooltip:focus .tooltiptext {\n            visibility: visible;\n            opacity: 1;\n        }\n\n        .proper-noun {\n            color: #d08770;\n            /* Coral Rose */\n            cursor: help;\n        }\n\n        .footer {\n            text-align: center;\n            padding-top: 20px;\n            font-size: 0.9em;\n            color: #888;\n        }\n\n        .footer a {\n            color: #aaa;\n            text-decoration: none;\n        }\n\n        .footer a:hover {\n            text-decoration: underline;\n        }\n\n        .footer span {\n            margin: 0 10px;\n        }\n    </style></head><body><div id=\"main-content\"><div id=\"story-container\"><img src=\"/static/fablemind_logo_cropped.jpg\" alt=\"Fable Mind Logo\" class=\"logo\" onclick=\"openFullscreen()\"><h1>Welcome, Traveler</h1><div class=\"rules\"><h3>How to Play</h3><ul><li>Read the story, then respond in 15 words or less</li><li>Your choices shape the narrative</li><li>Use quotes to speak, e.g. \"Hello there\"</li><li>Interact with anything and everything</li><li>To preemptively end the story, type \"end story\"</li></ul><h3>Tips</h3><ul><li>Be creative to solve puzzles and uncover secrets</li><li>The story can end in success or failure</li><li>Difficulty impacts the severity of consequences</li><li>The world is dynamic; your actions matter</li><li>Hover/tap item names in your inventory for details</li></ul><h3>Text Colors</h3><ul><li><span style=\"color: #a6e22e;\">Green:</span> Item acquired</li><li><span style=\"color: #f92672;\">Red:</span> Item lost</li><li><span style=\"color: #e2c8b9;\">Coral Rose:</span> Hover/tap for details</li></ul></div><div class=\"genre-buttons\"><button class=\"fantasy-btn\" hx-get=\"/start\" hx-vars=\"genre:'fantasy', consequence_model:document.getElementById('difficulty-selector').value\" hx-target=\"#main-content\" hx-swap=\"innerHTML\" hx-indicator=\"#loading-indicator\">Fantasy</button> <button class=\"scifi-btn\" hx-get=\"/start\" hx-vars=\"genre:'sci-fi', consequence_model:document.getElementById('difficulty-selector').value\" hx-target=\"#main-content\" hx-swap=\"innerHTML\" hx-indicator=\"#loading-indicator\">Sci-Fi</button> <button class=\"historical-fiction-btn\" hx-get=\"/start\" hx-vars=\"genre:'historical-fiction', consequence_model:document.getElementById('difficulty-selector').value\" hx-target=\"#main-content\" hx-swap=\"innerHTML\" hx-indicator=\"#loading-indicator\">Historical Fiction</button></div><div class=\"difficulty-container\"><label for=\"difficulty-selector\" class=\"difficulty-label\">Difficulty:</label> <select id=\"difficulty-selector\"><option value=\"exploratory\">Exploratory</option> <option value=\"challenging\" selected>Challenging</option> <option value=\"punishing\">Punishing</option></select></div></div><footer class=\"footer\"><span><a href=\"https://ko-fi.com/silastompkins\" target=\"_blank\">Support on Ko-fi</a></span> <span><a href=\"https://github.com/SeeSharpSi/ai_story_time\" target=\"_blank\">GitHub</a></span></footer></div><!-- Fullscreen Modal --><div id=\"fullscreen-modal\" class=\"fullscreen-modal\" onclick=\"closeFullscreen()\"><span class=\"close-modal\">&times;</span> <img src=\"/static/fablemind_logo_cropped.jpg\" alt=\"Fable Mind Logo Full Size\"></div><div id=\"loading-indicator\" class=\"htmx-indicator with-overlay\"><div class=\"loader\"></div><p class=\"loading-text\">Starting your story... <br>This can take up to 20 seconds</p></div><div id=\"spinner\" class=\"htmx-indicator\"><div class=\"loader\"></div></div><script>\n        document.body.addEventListener('htmx:afterSwap', function (evt) {\n            // Scroll the entire window to the bottom to show the new content\n            window.scrollTo(0, document.body.scrollHeight);\n        });\n\n        document.body.addEventListener('htmx:beforeRequest', function (evt) {\n            const trigger = evt.detail.elt;\n            // Check if the trigger is one of the genre buttons\n            if (trigger.classList.contains('fantasy-btn') || trigger.classList.contains('scifi-btn') || trigger.classList.contains('historical-fiction-btn')) {\n                const style = getComputedStyle(trigger);\n                const borderColor = style.borderColor;\n\n                const loadingText = document.querySelector('#loading-indicator .loading-text');\n                if (loadingText) {\n                    loadingText.style.border = `2px solid ${borderColor}`;\n                }\n\n                const loader = document.querySelector('#loading-indicator .loader');\n                if (loader) {\n                    loader.style.borderTopColor = borderColor;\n                }\n\n                const spinner = document.querySelector('#spinner .loader');\n                if (loader) {\n                    spinner.style.borderBottomColor = borderColor;\n                }\n            }\n        });\n\n        // This function handles the dynamic positioning of tooltips.\n        function positionTooltip(event) {\n            const tooltipContainer = event.target.closest('.tooltip');\n            if (!tooltipContainer) {\n                return;\n            }\n\n            const tooltipText = tooltipContainer.querySelector('.tooltiptext');\n            if (!tooltipText) {\n                return;\n            }\n\n            // Make it briefly visible but off-screen to calculate its height\n            tooltipText.style.visibility = 'hidden';\n            tooltipText.style.display = 'block';\n            const tooltipHeight = tooltipText.offsetHeight;\n            tooltipText.style.display = '';\n            tooltipText.style.visibility = '';\n\n\n            const containerRect = tooltipContainer.getBoundingClientRect();\n\n            // Check if there's enough space above the element in the viewport\n            // We add a small buffer (e.g., 10px) for safety\n            if (containerRect.top < (tooltipHeight + 10)) {\n                // If not enough space above, show it below\n                tooltipText.classList.add('tooltip-bottom');\n            } else {\n                // Otherwise, show it above (its default position)\n                tooltipText.classList.remove('tooltip-bottom');\n            }\n        }\n\n        // Use event delegation on the body to handle tooltips added by HTMX.\n        // 'mouseenter' is for desktop hover.\n        // 'focusin' is for mobile tap and keyboard navigation (thanks to tabindex=\"0\").\n        document.body.addEventListener('mouseenter', positionTooltip, true);\n        document.body.addEventListener('focusin', positionTooltip, true);\n\n        // Fullscreen modal functions\n        function openFullscreen() {\n            document.getElementById('fullscreen-modal').style.display = 'flex';\n            document.body.style.overflow = 'hidden'; // Prevent background scrolling\n        }\n\n        function closeFullscreen() {\n            document.getElementById('fullscreen-modal').style.display = 'none';\n            document.body.style.overflow = 'auto'; // Re-enable scrolling\n        }\n\n        // Close modal with Escape key\n        document.addEventListener('keydown', function(event) {\n            if (event.key === 'Escape') {\n                closeFullscreen();\n            }\n        });\n    </script></body></html>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "</title><meta charset=\"UTF-8\"><meta name=\"viewport\" content=\"width=device-width, initial-scale=1.0\"><!-- Open Graph / Facebook / LinkedIn --><meta property=\"og:type\" content=\"website\"><meta property=\"og:url\" content=\"https://github.com/SeeSharpSi/story_ai\"><meta property=\"og:title\" content=\"Fable Mind - An Interactive Text-Based Adventure\"><meta property=\"og:description\" content=\"An interactive, text-based adventure game powered by Google's Gemini API. Craft a unique story, choose your genre, and survive a challenging world.\"><meta property=\"og:image\" content=\"https://github.com/user-attachments/assets/131c1b8d-5373-4e93-87e8-940b57b83e6a\"><!-- Twitter --><meta property=\"twitter:card\" content=\"summary_large_image\"><meta property=\"twitter:url\" content=\"https://github.com/SeeSharpSi/story_ai\"><meta property=\"twitter:title\" content=\"Fable Mind - An Interactive Text-Based Adventure\"><meta property=\"twitter:description\" content=\"An interactive, text-based adventure game powered by Google's Gemini API. Craft a unique story, choose your genre, and survive a challenging world.\"><meta property=\"twitter:image\" content=\"https://github.com/user-attachments/assets/131c1b8d-5373-4e93-87e8-940b57b83e6a\"><link rel=\"icon\" href=\"/static/fablemind_logo_cropped.jpg\" type=\"image/jpeg\"><script src=\"/static/htmx.min.js\"></script><script src=\"/static/sse.js\"></script><link rel=\"preconnect\" href=\"https://fonts.googleapis.com\"><link rel=\"preconnect\" href=\"https://fonts.gstatic.com\" crossorigin><link href=\"https://fonts.googleapis.com/css2?family=JetBrains+Mono:ital,wght@0,400;0,700;1,400&display=swap\" rel=\"stylesheet\"><style>\n        :root {\n            --background-color: #181818;\n            /* Light Grey */\n            --primary-color: #3498db;\n            /* Default Blue */\n            --send-button-color: #3498db;\n            /* Default Blue */\n        }\n\n        .theme-fantasy {\n            --primary-color: #8e44ad;\n            /* Wisteria Purple */\n            --send-button-color: #8e44ad;\n            /* Wisteria Purple */\n        }\n\n        .theme-sci-fi {\n            --primary-color: #2980b9;\n            /* Belize Hole Blue */\n            --send-button-color: #2980b9;\n            /* Belize Hole Blue */\n        }\n\n        .theme-historical-fiction {\n            --primary-color: #c0392b;\n            /* Pomegranate Red */\n            --send-button-color: #c0392b;\n            /* Pomegranate Red */\n        }\n\n        html,\n        body {\n            overflow-x: hidden;\n        }\n\n        body {\n            font-family: 'JetBrains Mono', monospace;\n            margin: 0;\n            padding: 20px 15px;\n            background-color: var(--background-color);\n            color: #d4d4d4;\n            display: flex;\n            flex-direction: column;\n            justify-content: center;\n            align-items: center;\n            min-height: 100vh;\n            transition: background-color 0.5s;\n            box-sizing: border-box;\n        }\n\n        #main-content {\n            display: flex;\n            flex-direction: column;\n            justify-content: center;\n            align-items: center;\n            width: 100%;\n        }\n\n        #story-container {\n            max-width: 600px;\n            width: 98%;\n            background-color: #252526;\n            padding: 30px 40px 40px 40px;\n            border-radius: 8px;\n            box-shadow: 0 4px 8px rgba(0, 0, 0, 0.3);\n            text-align: center;\n            border: 1px solid #333333;\n            position: relative;\n            box-sizing: border-box;\n        }\n\n        h3 {\n            color: #ffffff;\n        }\n\n        h1 {\n            color: #ffffff;\n            margin-bottom: 10px;\n        }\n\n        .logo {\n            position: absolute;\n            top: 20px;\n            left: 20px;\n            width: 80px;\n            height: 80px;\n            border-radius: 8px;\n            opacity: 0.8;\n            transition: opacity 0.3s ease;\n        }\n\n        .logo:hover {\n            opacity: 1.0;\n            cursor: pointer;\n        }\n\n        .fullscreen-modal {\n            display: none;\n            position: fixed;\n            z-index: 1000;\n            left: 0;\n            top: 0;\n            width: 100%;\n            height: 100%;\n            background-color: rgba(0, 0, 0, 0.9);\n            justify-content: center;\n            align-items: center;\n            animation: fadeIn 0.3s ease;\n        }\n\n        .fullscreen-modal img {\n            max-width: 90%;\n            max-height: 90%;\n            border-radius: 8px;\n            box-shadow: 0 4px 20px rgba(0, 0, 0, 0.5);\n        }\n\n        .close-modal {\n            position: absolute;\n            top: 20px;\n            right: 40px;\n            color: #ffffff;\n            font-size: 40px;\n            font-weight: bold;\n            cursor: pointer;\n            transition: color 0.3s ease;\n        }\n\n        .close-modal:hover {\n            color: #cccccc;\n        }\n\n        @keyframes fadeIn {\n            from { opacity: 0; }\n            to { opacity: 1; }\n        }\n\n        /* Mobile Responsive Styles */\n        @media (max-width: 768px) {\n            .logo {\n                position: relative;\n                top: 0;\n                left: 0;\n                display: block;\n                margin: 0 auto 20px auto;\n                width: 60px;\n                height: 60px;\n            }\n\n            h1 {\n                margin-top: 10px;\n            }\n        }\n\n        .rules {\n            text-align: left;\n            margin-bottom: 30px;\n        }\n\n        .genre-buttons {\n            display: flex;\n            justify-content: center;\n            flex-wrap: wrap;\n            gap: 10px;\n            margin-top: 20px;\n        }\n\n        button {\n            font-family: 'JetBrains Mono', monospace;\n            padding: 10px 20px;\n            font-size: 1em;\n            border: 2px solid;\n            background-color: #333;\n            color: #d4d4d4;\n            border-radius: 4px;\n            cursor: pointer;\n            transition: background-color 0.3s, color 0.3s;\n            font-weight: bold;\n        }\n\n        .genre-buttons .fantasy-btn {\n            border-color: #8e44ad;\n        }\n\n        .genre-buttons .scifi-btn {\n            border-color: #2980b9;\n        }\n\n        .genre-buttons .historical-fiction-btn {\n            border-color: #c0392b;\n        }\n\n        .genre-buttons .fantasy-btn:hover {\n            background-color: #8e44ad;\n            color: white;\n        }\n\n        .genre-buttons .scifi-btn:hover {\n            background-color: #2980b9;\n            color: white;\n        }\n\n        .genre-buttons .historical-fiction-btn:hover {\n            background-color: #c0392b;\n            color: white;\n        }\n\n        #character-creation {\n            max-width: 480px;\n            margin: 0 auto;\n        }\n\n        .character-form {\n            display: flex;\n            flex-direction: column;\n            gap: 8px;\n            text-align: left;\n        }\n\n        .character-form input[type=\"text\"],\n        .character-form select {\n            font-family: 'JetBrains Mono', monospace;\n            padding: 8px;\n            background-color: #252526;\n            color: #d4d4d4;\n            border: 1px solid #444;\n            border-radius: 4px;\n        }\n\n        .character-traits {\n            display: grid;\n            grid-template-columns: repeat(2, 1fr);\n            gap: 4px 12px;\n            border: 1px solid #444;\n            border-radius: 4px;\n        }\n\n        .trait-hint {\n            color: #888;\n            font-size: 0.85em;\n        }\n\n        .trait-option:has(input:disabled) {\n            color: #666;\n        }\n\n        /* Make the Send button less prominent */\n        #response-form button {\n            border-color: var(--send-button-color);\n        }\n\n        #response-form button:hover {\n            background-color: var(--send-button-color);\n            color: white;\n        }\n\n        /* Spinner styles */\n        .loader {\n            border: 8px solid transparent;\n            border-top: 8px solid var(--background-color);\n            border-bottom: 8px solid white;\n            border-radius: 50%;\n            width: 60px;\n            height: 60px;\n            animation: spin 1s linear infinite;\n            pointer-events: auto;\n            /* Re-enable pointer events for the spinner */\n        }\n\n        @keyframes spin {\n            0% {\n                transform: rotate(0deg);\n            }\n\n            100% {\n                transform: rotate(360deg);\n            }\n        }\n\n        /* --- General Indicator Style (for #spinner) --- */\n        /* This provides a basic, centered position for any indicator. */\n        .htmx-indicator {\n            display: none;\n            position: fixed;\n            z-index: 1000;\n        }\n\n        .htmx-request.htmx-indicator,\n        .htmx-indicator.htmx-request {\n            display: flex;\n            justify-content: center;\n            align-items: center;\n            flex-direction: column;\n            top: 50%;\n            left: 50%;\n            transform: translate(-50%, -50%);\n        }\n\n\n        /* --- Overlay-Specific Style --- */\n        /* This targets ONLY our .with-overlay class to add the background\n                   and expand it to fill the screen. */\n        .htmx-request.with-overlay,\n        .with-overlay.htmx-request {\n            top: 0;\n            left: 0;\n            width: 100%;\n            height: 100%;\n            transform: none;\n            /* Reset the default centering transform */\n            background-color: rgba(37, 37, 38, 0.7);\n        }\n\n        #loading-indicator {\n            pointer-events: none;\n            /* Allow clicks to pass through the container */\n        }\n\n        .loading-text {\n            color: #d4d4d4;\n            margin-top: 15px;\n            font-style: italic;\n            background-color: rgba(40, 40, 40, 1);\n            /* Semi-transparent dark grey */\n            padding: 15px;\n            border-radius: 8px;\n            pointer-events: auto;\n            /* Re-enable pointer events for the text */\n            margin-left: 15px;\n            margin-right: 15px;\n            text-align: center;\n        }\n\n        /* Story view styles */\n        #story-history {\n            text-align: left;\n            margin-bottom: 20px;\n            border-bottom: 1px solid #333;\n            padding-bottom: 10px;\n        }\n\n        .streaming-text::after {\n            content: '▍';\n            animation: blink 1s step-end infinite;\n        }\n\n        @keyframes blink {\n            50% {\n                opacity: 0;\n            }\n        }\n\n        .page-button {\n            float: right;\n            padding: 0 6px;\n            background: none;\n            border: none;\n            color: #666;\n            font-size: 1em;\n            cursor: pointer;\n        }\n\n        .page-button:hover {\n            color: #4ec9b0;\n        }\n\n        #story-tools {\n            text-align: right;\n            margin-bottom: 10px;\n        }\n\n        #story-tools .page-button {\n            float: none;\n        }\n\n        .user-response {\n            color: #4ec9b0;\n            /* Teal */\n            font-style: italic;\n        }\n\n        .dice-roll {\n            margin-left: 10px;\n            font-size: 0.75em;\n            font-style: normal;\n            color: #666;\n            cursor: help;\n        }\n\n        .dice-success {\n            color: #6a9955;\n        }\n\n        .dice-failure {\n            color: #a05050;\n        }\n\n        .item-added {\n            color: #a6e22e;\n            /* Lime Green */\n            font-weight: bold;\n        }\n\n        .item-removed {\n            color: #f92672;\n            /* Pink/Red */\n            text-decoration: line-through;\n        }\n\n        .change-log {\n            list-style: none;\n            display: flex;\n            flex-wrap: wrap;\n            gap: 4px 14px;\n            margin: 6px 0 0;\n            padding: 0;\n            font-size: 0.75em;\n            color: #888;\n        }\n\n        .change-gain {\n            color: #a6e22e;\n        }\n\n        .change-loss {\n            color: #fd971f;\n        }\n\n        .change-move,\n        .change-npc {\n            color: #66d9ef;\n        }\n\n        .change-mismatch {\n            color: #e6db74;\n            cursor: help;\n        }\n\n        #response-form {\n            margin-bottom: 20px;\n        }\n\n        #prompt {\n            flex-grow: 1;\n            padding: 10px;\n            border: 1px solid #333;\n            border-radius: 4px;\n            background-color: #1e1e1e;\n            color: #d4d4d4;\n            font-family: 'JetBrains Mono', monospace;\n            margin-right: 10px;\n            /* Add space between input and button */\n            box-sizing: border-box;\n            /* Prevents padding from adding to the width */\n        }\n\n        #inventory {\n            text-align: left;\n            padding: 20px;\n            background-color: #252526;\n            border-radius: 8px;\n            border: 1px solid #333;\n            margin-top: 20px;\n        }\n\n        #branch-browser,\n        #branch-compare {\n            text-align: left;\n            padding: 20px;\n        }\n\n        .branch-table {\n            width: 100%;\n            border-collapse: collapse;\n            margin-bottom: 15px;\n            font-size: 0.9em;\n        }\n\n        .branch-table th,\n        .branch-table td {\n            padding: 6px 8px;\n            border-bottom: 1px solid #333;\n            text-align: left;\n        }\n\n        .branch-current {\n            background-color: #2a2d2e;\n        }\n\n        .branch-back {\n            margin-top: 15px;\n        }\n\n        .compare-shared {\n            opacity: 0.6;\n            border-bottom: 1px solid #333;\n            margin-bottom: 15px;\n        }\n\n        .compare-columns {\n            display: flex;\n            gap: 20px;\n        }\n\n        .compare-column {\n            flex: 1;\n            min-width: 0;\n        }\n\n        #journal {\n            text-align: left;\n            padding: 20px;\n            background-color: #252526;\n            border-radius: 8px;\n            border: 1px solid #333;\n            margin-top: 20px;\n        }\n\n        #journal h4 {\n            margin: 12px 0 6px;\n            color: #aaa;\n            font-size: 0.85em;\n            text-transform: uppercase;\n            letter-spacing: 0.05em;\n        }\n\n        .journal-list {\n            margin: 0;\n            padding-left: 18px;\n        }\n\n        .journal-detail,\n        .journal-empty {\n            color: #888;\n            font-style: italic;\n        }\n\n        .journal-solved li {\n            color: #a6e22e;\n        }\n\n        .journal-toggle {\n            margin-top: 12px;\n            font-size: 0.8em;\n        }\n\n        #world-map:not(:empty) {\n            text-align: left;\n            padding: 20px;\n            background-color: #252526;\n            border-radius: 8px;\n            border: 1px solid #333;\n            margin-top: 20px;\n        }\n\n        .world-map-svg {\n            display: block;\n            width: 100%;\n            max-height: 360px;\n        }\n\n        .map-edge {\n            stroke: #555;\n            stroke-width: 2;\n        }\n\n        .map-node rect {\n            fill: #1e1e1e;\n            stroke: #888;\n            stroke-width: 1.5;\n        }\n\n        .map-node text {\n            fill: #ccc;\n            font-size: 12px;\n            text-anchor: middle;\n            dominant-baseline: central;\n        }\n\n        .map-node-unvisited rect {\n            stroke: #555;\n            stroke-dasharray: 4 3;\n        }\n\n        .map-node-unvisited text {\n            fill: #777;\n            font-style: italic;\n        }\n\n        .map-node-current rect {\n            fill: #3a4a1e;\n            stroke: #a6e22e;\n            stroke-width: 2.5;\n        }\n\n        .map-node-current text {\n            fill: #fff;\n            font-weight: bold;\n        }\n\n        #word-count {\n            font-size: 0.8em;\n            color: #888;\n            margin-left: 10px;\n        }\n\n        /* Difficulty selector styles */\n        .difficulty-container {\n            margin-top: 20px;\n            display: flex;\n            justify-content: center;\n            align-items: center;\n            gap: 10px;\n        }\n\n        .difficulty-label {\n            font-size: 1.2em;\n            color: #ffffff;\n        }\n\n        #difficulty-selector {\n            font-family: 'JetBrains Mono', monospace;\n            padding: 8px 30px 8px 12px;\n            /* Add padding for the arrow */\n            border-radius: 4px;\n            border: 1px solid #555;\n            background-color: #333;\n            color: #d4d4d4;\n            -webkit-appearance: none;\n            /* Remove default arrow on Chrome/Safari */\n            -moz-appearance: none;\n            /* Remove default arrow on Firefox */\n            appearance: none;\n            background-image: url(\"data:image/svg+xml,%3Csvg xmlns='http://www.w3.org/2000/svg' width='12' height='12' fill='%23d4d4d4' viewBox='0 0 16 16'%3E%3Cpath d='M7.247 11.14L2.451 5.658C1.885 5.013 2.345 4 3.204 4h9.592a1 1 0 0 1 .753 1.659l-4.796 5.48a1 1 0 0 1-1.506 0z'/%3E%3C/svg%3E\");\n            background-repeat: no-repeat;\n            background-position: right 10px center;\n            cursor: pointer;\n            transition: border-color 0.3s;\n        }\n\n        #difficulty-selector:hover {\n            border-color: #666;\n        }\n\n        #difficulty-selector:focus {\n            outline: none;\n            border-color: #ffffff;\n        }\n\n        /* Player Status Bar */\n        #player-status {\n            text-align: left;\n            margin-bottom: 20px;\n            padding: 10px;\n            background-color: #1e1e1e;\n            border: 1px solid #333;\n            border-radius: 4px;\n        }\n\n        .condition {\n            color: #fd971f;\n            /* Orange */\n            font-style: italic;\n        }\n\n        .condition-sev-1 {\n            color: #e6db74;\n        }\n\n        .condition-sev-3 {\n            color: #f92672;\n            font-weight: bold;\n        }\n\n        .inventory-item {\n            display: flex;\n            justify-content: space-between;\n            align-items: center;\n            padding: 8px 0;\n        }\n\n        .item-properties {\n            font-style: italic;\n            color: #888;\n            /* Faint color */\n        }\n\n        .inventory-divider {\n            border: 0;\n            height: 1px;\n            background-color: #444;\n            margin: 0;\n        }\n\n        /* Tooltip Styles */\n        .tooltip {\n            position: relative;\n            display: inline;\n            cursor: help;\n        }\n\n        .tooltip .tooltiptext {\n            visibility: hidden;\n            width: 160px;\n            background-color: #555;\n            color: #fff;\n            text-align: center;\n            border-radius: 6px;\n            padding: 5px;\n            position: absolute;\n            z-index: 1;\n            bottom: 125%;\n            left: 50%;\n            margin-left: -80px;\n            opacity: 0;\n            transition: opacity 0.3s;\n        }\n\n        .tooltip .tooltiptext.tooltip-bottom {\n            bottom: auto;\n            top: 125%;\n        }\n\n        .tooltip:hover .tooltiptext,\n        .tooltip:focus .tooltiptext {\n            visibility: visible;\n            opacity: 1;\n        }\n\n        .proper-noun {\n            color: #d08770;\n            /* Coral Rose */\n            cursor: help;\n        }\n\n        .footer {\n            text-align: center;\n            padding-top: 20px;\n            font-size: 0.9em;\n            color: #888;\n        }\n\n        .footer a {\n            color: #aaa;\n            text-decoration: none;\n        }\n\n        .footer a:hover {\n            text-decoration: underline;\n        }\n\n        .footer span {\n            margin: 0 10px;\n        }\n    </style></head><body><div id=\"main-content\"><div id=\"story-container\"><img src=\"/static/fablemind_logo_cropped.jpg\" alt=\"Fable Mind Logo\" class=\"logo\" onclick=\"openFullscreen()\"><h1>Welcome, Traveler</h1><div class=\"rules\"><h3>How to Play</h3><ul><li>Read the story, then respond in 15 words or less</li><li>Your choices shape the narrative</li><li>Use quotes to speak, e.g. \"Hello there\"</li><li>Interact with anything and everything</li><li>To preemptively end the story, type \"end story\"</li></ul><h3>Tips</h3><ul><li>Be creative to solve puzzles and uncover secrets</li><li>The story can end in success or failure</li><li>Difficulty impacts the severity of consequences</li><li>The world is dynamic; your actions matter</li><li>Hover/tap item names in your inventory for details</li></ul><h3>Text Colors</h3><ul><li><span style=\"color: #a6e22e;\">Green:</span> Item acquired</li><li><span style=\"color: #f92672;\">Red:</span> Item lost</li><li><span style=\"color: #e2c8b9;\">Coral Rose:</span> Hover/tap for details</li></ul></div><div class=\"genre-buttons\"><button class=\"fantasy-btn\" hx-get=\"/character\" hx-vars=\"genre:'fantasy', consequence_model:document.getElementById('difficulty-selector').value\" hx-target=\"#main-content\" hx-swap=\"innerHTML\">Fantasy</button> <button class=\"scifi-btn\" hx-get=\"/character\" hx-vars=\"genre:'sci-fi', consequence_model:document.getElementById('difficulty-selector').value\" hx-target=\"#main-content\" hx-swap=\"innerHTML\">Sci-Fi</button> <button class=\"historical-fiction-btn\" hx-get=\"/character\" hx-vars=\"genre:'historical-fiction', consequence_model:document.getElementById('difficulty-selector').value\" hx-target=\"#main-content\" hx-swap=\"innerHTML\">Historical Fiction</button></div><div class=\"difficulty-container\"><label for=\"difficulty-selector\" class=\"difficulty-label\">Difficulty:</label> <select id=\"difficulty-selector\"><option value=\"exploratory\">Exploratory</option> <option value=\"challenging\" selected>Challenging</option> <option value=\"punishing\">Punishing</option></select></div></div><footer class=\"footer\"><span><a href=\"https://ko-fi.com/silastompkins\" target=\"_blank\">Support on Ko-fi</a></span> <span><a href=\"https://github.com/SeeSharpSi/ai_story_time\" target=\"_blank\">GitHub</a></span></footer></div><!-- Fullscreen Modal --><div id=\"fullscreen-modal\" class=\"fullscreen-modal\" onclick=\"closeFullscreen()\"><span class=\"close-modal\">&times;</span> <img src=\"/static/fablemind_logo_cropped.jpg\" alt=\"Fable Mind Logo Full Size\"></div><div id=\"loading-indicator\" class=\"htmx-indicator with-overlay\"><div class=\"loader\"></div><p class=\"loading-text\">Starting your story... <br>This can take up to 20 seconds</p></div><div id=\"spinner\" class=\"htmx-indicator\"><div class=\"loader\"></div></div><script>\n        document.body.addEventListener('htmx:afterSwap', function (evt) {\n            // Scroll the entire window to the bottom to show the new content\n            window.scrollTo(0, document.body.scrollHeight);\n        });\n\n        // Keep the streaming story text in view as it arrives\n        document.body.addEventListener('htmx:sseMessage', function (evt) {\n            window.scrollTo(0, document.body.scrollHeight);\n        });\n\n        document.body.addEventListener('htmx:beforeRequest', function (evt) {\n            // The character form starts the story; colour the loading screen by its genre button\n            const trigger = evt.detail.elt.matches('.character-form') ? evt.detail.elt.querySelector('button[type=\"submit\"]') : evt.detail.elt;\n            // Check if the trigger is one of the genre buttons\n            if (trigger.classList.contains('fantasy-btn') || trigger.classList.contains('scifi-btn') || trigger.classList.contains('historical-fiction-btn')) {\n                const style = getComputedStyle(trigger);\n                const borderColor = style.borderColor;\n\n                const loadingText = document.querySelector('#loading-indicator .loading-text');\n                if (loadingText) {\n                    loadingText.style.border = `2px solid ${borderColor}`;\n                }\n\n                const loader = document.querySelector('#loading-indicator .loader');\n                if (loader) {\n                    loader.style.borderTopColor = borderColor;\n                }\n\n                const spinner = document.querySelector('#spinner .loader');\n                if (loader) {\n                    spinner.style.borderBottomColor = borderColor;\n                }\n            }\n        });\n\n        // This function handles the dynamic positioning of tooltips.\n        function positionTooltip(event) {\n            const tooltipContainer = event.target.closest('.tooltip');\n            if (!tooltipContainer) {\n                return;\n            }\n\n            const tooltipText = tooltipContainer.querySelector('.tooltiptext');\n            if (!tooltipText) {\n                return;\n            }\n\n            // Make it briefly visible but off-screen to calculate its height\n            tooltipText.style.visibility = 'hidden';\n            tooltipText.style.display = 'block';\n            const tooltipHeight = tooltipText.offsetHeight;\n            tooltipText.style.display = '';\n            tooltipText.style.visibility = '';\n\n\n            const containerRect = tooltipContainer.getBoundingClientRect();\n\n            // Check if there's enough space above the element in the viewport\n            // We add a small buffer (e.g., 10px) for safety\n            if (containerRect.top < (tooltipHeight + 10)) {\n                // If not enough space above, show it below\n                tooltipText.classList.add('tooltip-bottom');\n            } else {\n                // Otherwise, show it above (its default position)\n                tooltipText.classList.remove('tooltip-bottom');\n            }\n        }\n\n        // Use event delegation on the body to handle tooltips added by HTMX.\n        // 'mouseenter' is for desktop hover.\n        // 'focusin' is for mobile tap and keyboard navigation (thanks to tabindex=\"0\").\n        document.body.addEventListener('mouseenter', positionTooltip, true);\n        document.body.addEventListener('focusin', positionTooltip, true);\n\n        // Fullscreen modal functions\n        function openFullscreen() {\n            document.getElementById('fullscreen-modal').style.display = 'flex';\n            document.body.style.overflow = 'hidden'; // Prevent background scrolling\n        }\n\n        function closeFullscreen() {\n            document.getElementById('fullscreen-modal').style.display = 'none';\n            document.body.style.overflow = 'auto'; // Re-enable scrolling\n        }\n\n        // Close modal with Escape key\n        document.addEventListener('keydown', function(event) {\n            if (event.key === 'Escape') {\n                closeFullscreen();\n            }\n        });\n    </script></body></html>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
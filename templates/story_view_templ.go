@@ -10,9 +10,8 @@ import templruntime "github.com/a-h/templ/runtime"
 
 import "fmt"
 import "story_ai/story"
-import "strings"
 
-func StoryView(initialStory string, playerStatus story.PlayerStatus, inventory []story.Item, bgColor string, genre string, worldTension int, difficulty string, placeholder string) templ.Component {
+func StoryView(storyHistory []story.StoryPage, playerStatus story.PlayerStatus, inventory []story.Item, bgColor string, genre string, worldTension int, difficulty string, placeholder string, worldMap *story.WorldMap, journal story.JournalView, canRewind bool, gameOver bool, author string, totalTokens int) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
@@ -63,73 +62,100 @@ func StoryView(initialStory string, playerStatus story.PlayerStatus, inventory [
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "</div><div id=\"story-history\"><div class=\"story-page\">")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "</div><div id=\"story-history\">")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templ.Raw(initialStory).Render(ctx, templ_7745c5c3_Buffer)
+		templ_7745c5c3_Err = StoryPages(storyHistory, canRewind).Render(ctx, templ_7745c5c3_Buffer)
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "</div></div><div id=\"player-status\"><strong>Status:</strong> <span style=\"")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "</div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		var templ_7745c5c3_Var4 string
-		templ_7745c5c3_Var4, templ_7745c5c3_Err = templruntime.SanitizeStyleAttributeValues(fmt.Sprintf("color: %s;", GetHealthStatus(playerStatus.Health).Color))
+		templ_7745c5c3_Err = PlayerStatusPanel(playerStatus, false).Render(ctx, templ_7745c5c3_Buffer)
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `templates/story_view.templ`, Line: 22, Col: 86}
+			return templ_7745c5c3_Err
+		}
+		if gameOver {
+			templ_7745c5c3_Err = GameOverActions(author, totalTokens, false).Render(ctx, templ_7745c5c3_Buffer)
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		} else {
+			templ_7745c5c3_Err = ResponseForm(difficulty, placeholder, false).Render(ctx, templ_7745c5c3_Buffer)
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
 		}
-		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var4))
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "<div id=\"story-tools\"><button class=\"page-button\" hx-get=\"/branches\" hx-target=\"#main-content\" hx-swap=\"innerHTML\">⑂ Branches</button></div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "\">")
+		templ_7745c5c3_Err = InventoryPanel(inventory, difficulty, false).Render(ctx, templ_7745c5c3_Buffer)
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		var templ_7745c5c3_Var5 string
-		templ_7745c5c3_Var5, templ_7745c5c3_Err = templ.JoinStringErrs(GetHealthStatus(playerStatus.Health).Description)
+		templ_7745c5c3_Err = WorldMapPanel(worldMap, false).Render(ctx, templ_7745c5c3_Buffer)
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `templates/story_view.templ`, Line: 22, Col: 139}
+			return templ_7745c5c3_Err
 		}
-		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var5))
+		templ_7745c5c3_Err = JournalPanel(journal, false).Render(ctx, templ_7745c5c3_Buffer)
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "</span> ")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "<style>\n\t\t\t.inventory-item {\n\t\t\t\tdisplay: flex;\n\t\t\t\tjustify-content: space-between;\n\t\t\t\talign-items: center;\n\t\t\t\tpadding: 8px 0;\n\t\t\t}\n\t\t\t.item-properties {\n\t\t\t\tfont-style: italic;\n\t\t\t\tcolor: #888; /* Faint color */\n                \ttext-align: right;\n\t\t\t}\n\t\t\t.item-badge {\n\t\t\t\tfont-style: normal;\n\t\t\t\tfont-size: 0.8em;\n\t\t\t\tmargin-right: 6px;\n\t\t\t\tpadding: 0 4px;\n\t\t\t\tborder: 1px solid #444;\n\t\t\t\tborder-radius: 3px;\n\t\t\t}\n\t\t\t.badge-equipped {\n\t\t\t\tcolor: #66d9ef;\n\t\t\t\tborder-color: #66d9ef;\n\t\t\t}\n\t\t\t.badge-worn {\n\t\t\t\tcolor: #e6db74;\n\t\t\t}\n\t\t\t.badge-low {\n\t\t\t\tcolor: #f92672;\n\t\t\t\tborder-color: #f92672;\n\t\t\t}\n\t\t\t.inventory-load {\n\t\t\t\tfloat: right;\n\t\t\t\tfont-size: 0.7em;\n\t\t\t\tfont-weight: normal;\n\t\t\t}\n\t\t\t.load-light {\n\t\t\t\tcolor: #888;\n\t\t\t}\n\t\t\t.load-heavy {\n\t\t\t\tcolor: #fd971f;\n\t\t\t}\n\t\t\t.load-over {\n\t\t\t\tcolor: #f92672;\n\t\t\t}\n\t\t\t.inventory-divider {\n\t\t\t\tborder: 0;\n\t\t\t\theight: 1px;\n\t\t\t\tbackground-color: #444;\n\t\t\t\tmargin: 0;\n\t\t\t}\n\n\t\t\t#response-form button:disabled {\n\t\t\t\topacity: 0.6;\n\t\t\t\tcursor: not-allowed;\n\t\t\t}\n\n\t\t\t.button-loading {\n\t\t\t\tdisplay: flex;\n\t\t\t\talign-items: center;\n\t\t\t\tgap: 8px;\n\t\t\t}\n\t\t</style></div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		if len(playerStatus.Conditions) > 0 {
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "<span>| </span><span class=\"condition\">")
-			if templ_7745c5c3_Err != nil {
-				return templ_7745c5c3_Err
-			}
-			var templ_7745c5c3_Var6 string
-			templ_7745c5c3_Var6, templ_7745c5c3_Err = templ.JoinStringErrs(strings.Join(playerStatus.Conditions, ", "))
-			if templ_7745c5c3_Err != nil {
-				return templ.Error{Err: templ_7745c5c3_Err, FileName: `templates/story_view.templ`, Line: 24, Col: 89}
-			}
-			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var6))
-			if templ_7745c5c3_Err != nil {
-				return templ_7745c5c3_Err
-			}
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 8, "</span>")
+		return nil
+	})
+}
+
+// ResponseForm is the prompt box and its word counter. oob swaps it back into a page
+// whose game-over buttons replaced it.
+func ResponseForm(difficulty string, placeholder string, oob bool) templ.Component {
+	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
+		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
+		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
+			return templ_7745c5c3_CtxErr
+		}
+		templ_7745c5c3_Buffer, templ_7745c5c3_IsBuffer := templruntime.GetBuffer(templ_7745c5c3_W)
+		if !templ_7745c5c3_IsBuffer {
+			defer func() {
+				templ_7745c5c3_BufErr := templruntime.ReleaseBuffer(templ_7745c5c3_Buffer)
+				if templ_7745c5c3_Err == nil {
+					templ_7745c5c3_Err = templ_7745c5c3_BufErr
+				}
+			}()
+		}
+		ctx = templ.InitializeContext(ctx)
+		templ_7745c5c3_Var4 := templ.GetChildren(ctx)
+		if templ_7745c5c3_Var4 == nil {
+			templ_7745c5c3_Var4 = templ.NopComponent
+		}
+		ctx = templ.ClearChildren(ctx)
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "<form id=\"response-form\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		if oob {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 8, " hx-swap-oob=\"true\"")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 9, "</div><form id=\"response-form\" hx-post=\"/generate\" hx-target=\"body\" hx-swap=\"none\" hx-indicator=\"#spinner\"><input type=\"text\" id=\"prompt\" name=\"prompt\" autofocus=\"autofocus\" autocomplete=\"off\" placeholder=\"")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 9, " hx-post=\"/generate\" hx-target=\"body\" hx-swap=\"none\" hx-indicator=\"#spinner\"><input type=\"text\" id=\"prompt\" name=\"prompt\" autofocus=\"autofocus\" autocomplete=\"off\" placeholder=\"")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		var templ_7745c5c3_Var7 string
-		templ_7745c5c3_Var7, templ_7745c5c3_Err = templ.JoinStringErrs(fmt.Sprintf("%s", placeholder))
+		var templ_7745c5c3_Var5 string
+		templ_7745c5c3_Var5, templ_7745c5c3_Err = templ.JoinStringErrs(fmt.Sprintf("%s", placeholder))
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `templates/story_view.templ`, Line: 29, Col: 133}
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `templates/story_view.templ`, Line: 105, Col: 132}
 		}
-		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var7))
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var5))
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -137,71 +163,16 @@ func StoryView(initialStory string, playerStatus story.PlayerStatus, inventory [
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		var templ_7745c5c3_Var8 string
-		templ_7745c5c3_Var8, templ_7745c5c3_Err = templ.JoinStringErrs(difficulty)
+		var templ_7745c5c3_Var6 string
+		templ_7745c5c3_Var6, templ_7745c5c3_Err = templ.JoinStringErrs(difficulty)
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `templates/story_view.templ`, Line: 35, Col: 81}
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `templates/story_view.templ`, Line: 111, Col: 80}
 		}
-		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var8))
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var6))
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 11, "</span> <span id=\"word-count\">0/15 words</span></div></form><div id=\"inventory\"><h3>Inventory</h3><div class=\"inventory-items\">")
-		if templ_7745c5c3_Err != nil {
-			return templ_7745c5c3_Err
-		}
-		for i, item := range inventory {
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 12, "<div class=\"inventory-item\"><span class=\"item-name tooltip\" tabindex=\"0\">")
-			if templ_7745c5c3_Err != nil {
-				return templ_7745c5c3_Err
-			}
-			var templ_7745c5c3_Var9 string
-			templ_7745c5c3_Var9, templ_7745c5c3_Err = templ.JoinStringErrs(item.Name)
-			if templ_7745c5c3_Err != nil {
-				return templ.Error{Err: templ_7745c5c3_Err, FileName: `templates/story_view.templ`, Line: 45, Col: 62}
-			}
-			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var9))
-			if templ_7745c5c3_Err != nil {
-				return templ_7745c5c3_Err
-			}
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 13, " <span class=\"tooltiptext\">")
-			if templ_7745c5c3_Err != nil {
-				return templ_7745c5c3_Err
-			}
-			var templ_7745c5c3_Var10 string
-			templ_7745c5c3_Var10, templ_7745c5c3_Err = templ.JoinStringErrs(item.Description)
-			if templ_7745c5c3_Err != nil {
-				return templ.Error{Err: templ_7745c5c3_Err, FileName: `templates/story_view.templ`, Line: 46, Col: 51}
-			}
-			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var10))
-			if templ_7745c5c3_Err != nil {
-				return templ_7745c5c3_Err
-			}
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 14, "</span></span> <span class=\"item-properties\">")
-			if templ_7745c5c3_Err != nil {
-				return templ_7745c5c3_Err
-			}
-			var templ_7745c5c3_Var11 string
-			templ_7745c5c3_Var11, templ_7745c5c3_Err = templ.JoinStringErrs(FormatProperties(item.Properties))
-			if templ_7745c5c3_Err != nil {
-				return templ.Error{Err: templ_7745c5c3_Err, FileName: `templates/story_view.templ`, Line: 48, Col: 71}
-			}
-			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var11))
-			if templ_7745c5c3_Err != nil {
-				return templ_7745c5c3_Err
-			}
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 15, "</span></div>")
-			if templ_7745c5c3_Err != nil {
-				return templ_7745c5c3_Err
-			}
-			if i < len(inventory)-1 {
-				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 16, "<hr class=\"inventory-divider\">")
-				if templ_7745c5c3_Err != nil {
-					return templ_7745c5c3_Err
-				}
-			}
-		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 17, "</div></div><style>\n\t\t\t.inventory-item {\n\t\t\t\tdisplay: flex;\n\t\t\t\tjustify-content: space-between;\n\t\t\t\talign-items: center;\n\t\t\t\tpadding: 8px 0;\n\t\t\t}\n\t\t\t.item-properties {\n\t\t\t\tfont-style: italic;\n\t\t\t\tcolor: #888; /* Faint color */\n                \ttext-align: right;\n\t\t\t}\n\t\t\t.inventory-divider {\n\t\t\t\tborder: 0;\n\t\t\t\theight: 1px;\n\t\t\t\tbackground-color: #444;\n\t\t\t\tmargin: 0;\n\t\t\t}\n\n\t\t\t#response-form button:disabled {\n\t\t\t\topacity: 0.6;\n\t\t\t\tcursor: not-allowed;\n\t\t\t}\n\n\t\t\t.button-loading {\n\t\t\t\tdisplay: flex;\n\t\t\t\talign-items: center;\n\t\t\t\tgap: 8px;\n\t\t\t}\n\t\t</style><script>\n\t\t\tconst promptInput = document.getElementById('prompt');\n\t\t\tconst wordCountSpan = document.getElementById('word-count');\n\t\t\tconst responseForm = document.getElementById('response-form');\n\n\t\t\tpromptInput.addEventListener('input', () => {\n\t\t\t\tconst words = promptInput.value.trim().split(/\\s+/).filter(Boolean);\n\t\t\t\tlet wordCount = words.length;\n\t\t\t\tif (promptInput.value.trim() === \"\") {\n\t\t\t\t\twordCount = 0;\n\t\t\t\t}\n\t\t\t\twordCountSpan.textContent = `${wordCount}/15 words`;\n\t\t\t\tif (wordCount > 15) {\n\t\t\t\t\twordCountSpan.style.color = 'red';\n\t\t\t\t} else {\n\t\t\t\t\twordCountSpan.style.color = '#888';\n\t\t\t\t}\n\t\t\t});\n\n\t\t\tresponseForm.addEventListener('submit', (e) => {\n\t\t\t\tconst words = promptInput.value.trim().split(/\\s+/).filter(Boolean);\n\t\t\t\tif (words.length > 15) {\n\t\t\t\t\te.preventDefault();\n\t\t\t\t\talert('Your response cannot be more than 15 words.');\n\t\t\t\t}\n\t\t\t});\n\n\t\t\tresponseForm.addEventListener('htmx:beforeRequest', function(evt) {\n\t\t\t\t// Show loading state\n\t\t\t\tconst buttonText = responseForm.querySelector('.button-text');\n\t\t\t\tconst buttonLoading = responseForm.querySelector('.button-loading');\n\t\t\t\tconst submitButton = responseForm.querySelector('button[type=\"submit\"]');\n\n\t\t\t\tif (buttonText && buttonLoading) {\n\t\t\t\t\tbuttonText.style.display = 'none';\n\t\t\t\t\tbuttonLoading.style.display = 'inline';\n\t\t\t\t}\n\t\t\t\tsubmitButton.disabled = true;\n\t\t\t\tpromptInput.disabled = true;\n\t\t\t});\n\n\t\t\tresponseForm.addEventListener('htmx:afterRequest', function(evt) {\n\t\t\t\t// Reset loading state\n\t\t\t\tconst buttonText = responseForm.querySelector('.button-text');\n\t\t\t\tconst buttonLoading = responseForm.querySelector('.button-loading');\n\t\t\t\tconst submitButton = responseForm.querySelector('button[type=\"submit\"]');\n\n\t\t\t\tif (buttonText && buttonLoading) {\n\t\t\t\t\tbuttonText.style.display = 'inline';\n\t\t\t\t\tbuttonLoading.style.display = 'none';\n\t\t\t\t}\n\t\t\t\tsubmitButton.disabled = false;\n\t\t\t\tpromptInput.disabled = false;\n\n\t\t\t\tif (evt.detail.successful) {\n\t\t\t\t\tpromptInput.value = '';\n\t\t\t\t\twordCountSpan.textContent = '0/15 words';\n\t\t\t\t\twordCountSpan.style.color = '#666';\n\t\t\t\t}\n\t\t\t});\n\t\t</script></div>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 11, "</span> <span id=\"word-count\">0/15 words</span></div><script>\n\t\t\t// Wrapped so the form can be swapped back in after a rewind.\n\t\t\t(() => {\n\t\t\t\tconst promptInput = document.getElementById('prompt');\n\t\t\t\tconst wordCountSpan = document.getElementById('word-count');\n\t\t\t\tconst responseForm = document.getElementById('response-form');\n\n\t\t\t\tpromptInput.addEventListener('input', () => {\n\t\t\t\t\tconst words = promptInput.value.trim().split(/\\s+/).filter(Boolean);\n\t\t\t\t\tlet wordCount = words.length;\n\t\t\t\t\tif (promptInput.value.trim() === \"\") {\n\t\t\t\t\t\twordCount = 0;\n\t\t\t\t\t}\n\t\t\t\t\twordCountSpan.textContent = `${wordCount}/15 words`;\n\t\t\t\t\tif (wordCount > 15) {\n\t\t\t\t\t\twordCountSpan.style.color = 'red';\n\t\t\t\t\t} else {\n\t\t\t\t\t\twordCountSpan.style.color = '#888';\n\t\t\t\t\t}\n\t\t\t\t});\n\n\t\t\t\tresponseForm.addEventListener('submit', (e) => {\n\t\t\t\t\tconst words = promptInput.value.trim().split(/\\s+/).filter(Boolean);\n\t\t\t\t\tif (words.length > 15) {\n\t\t\t\t\t\te.preventDefault();\n\t\t\t\t\t\talert('Your response cannot be more than 15 words.');\n\t\t\t\t\t}\n\t\t\t\t});\n\n\t\t\t\tresponseForm.addEventListener('htmx:beforeRequest', function(evt) {\n\t\t\t\t\t// Show loading state\n\t\t\t\t\tconst buttonText = responseForm.querySelector('.button-text');\n\t\t\t\t\tconst buttonLoading = responseForm.querySelector('.button-loading');\n\t\t\t\t\tconst submitButton = responseForm.querySelector('button[type=\"submit\"]');\n\n\t\t\t\t\tif (buttonText && buttonLoading) {\n\t\t\t\t\t\tbuttonText.style.display = 'none';\n\t\t\t\t\t\tbuttonLoading.style.display = 'inline';\n\t\t\t\t\t}\n\t\t\t\t\tsubmitButton.disabled = true;\n\t\t\t\t\tpromptInput.disabled = true;\n\t\t\t\t});\n\n\t\t\t\tresponseForm.addEventListener('htmx:afterRequest', function(evt) {\n\t\t\t\t\t// Reset loading state\n\t\t\t\t\tconst buttonText = responseForm.querySelector('.button-text');\n\t\t\t\t\tconst buttonLoading = responseForm.querySelector('.button-loading');\n\t\t\t\t\tconst submitButton = responseForm.querySelector('button[type=\"submit\"]');\n\n\t\t\t\t\tif (buttonText && buttonLoading) {\n\t\t\t\t\t\tbuttonText.style.display = 'inline';\n\t\t\t\t\t\tbuttonLoading.style.display = 'none';\n\t\t\t\t\t}\n\t\t\t\t\tsubmitButton.disabled = false;\n\t\t\t\t\tpromptInput.disabled = false;\n\n\t\t\t\t\tif (evt.detail.successful) {\n\t\t\t\t\t\tpromptInput.value = '';\n\t\t\t\t\t\twordCountSpan.textContent = '0/15 words';\n\t\t\t\t\t\twordCountSpan.style.color = '#666';\n\t\t\t\t\t}\n\t\t\t\t});\n\t\t\t})();\n\t\t</script></form>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
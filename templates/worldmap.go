@@ -0,0 +1,60 @@
+package templates
+
+import (
+	"fmt"
+	"html"
+	"story_ai/story"
+	"strings"
+)
+
+// Sizes of the world map SVG, in pixels.
+const (
+	mapCellWidth  = 130
+	mapCellHeight = 64
+	mapNodeWidth  = 112
+	mapNodeHeight = 28
+	mapLabelRunes = 16
+)
+
+// WorldMapSVG draws the world map as an inline SVG, with the current room highlighted
+// and rooms only seen through an exit drawn dashed.
+func WorldMapSVG(m *story.WorldMap) string {
+	if m == nil || len(m.Nodes) == 0 {
+		return ""
+	}
+	points := m.Layout()
+	cols, rows := 0, 0
+	for _, p := range points {
+		cols, rows = max(cols, p.X+1), max(rows, p.Y+1)
+	}
+	center := func(name string) (int, int) {
+		p := points[name]
+		return p.X*mapCellWidth + mapCellWidth/2, p.Y*mapCellHeight + mapCellHeight/2
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="world-map-svg" xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" role="img" aria-label="Map of visited locations">`, cols*mapCellWidth, rows*mapCellHeight)
+	for _, e := range m.Connections() {
+		x1, y1 := center(e.From)
+		x2, y2 := center(e.To)
+		fmt.Fprintf(&b, `<line class="map-edge" x1="%d" y1="%d" x2="%d" y2="%d"><title>%s</title></line>`, x1, y1, x2, y2, html.EscapeString(e.From+" → "+e.Direction+" → "+e.To))
+	}
+	for _, n := range m.Nodes {
+		x, y := center(n.Name)
+		class := "map-node"
+		switch {
+		case n.Name == m.Current:
+			class += " map-node-current"
+		case !n.Visited:
+			class += " map-node-unvisited"
+		}
+		label := n.Name
+		if runes := []rune(label); len(runes) > mapLabelRunes {
+			label = string(runes[:mapLabelRunes-1]) + "…"
+		}
+		fmt.Fprintf(&b, `<g class="%s"><title>%s</title><rect x="%d" y="%d" width="%d" height="%d" rx="6"/><text x="%d" y="%d">%s</text></g>`,
+			class, html.EscapeString(n.Name), x-mapNodeWidth/2, y-mapNodeHeight/2, mapNodeWidth, mapNodeHeight, x, y, html.EscapeString(label))
+	}
+	b.WriteString(`</svg>`)
+	return b.String()
+}